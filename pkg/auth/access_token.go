@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,19 +13,37 @@ import (
 )
 
 type AccessTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
 }
 
 func PollForAccessToken(ctx context.Context, config Config, deviceCode string, timeout time.Duration, interval time.Duration) (*AccessTokenResponse, error) {
-	// Serialize the payload to form-encoded format
 	payload := url.Values{
-		"client_id":   []string{config.ClientId},
 		"device_code": []string{deviceCode},
 		"grant_type":  []string{DeviceCode.String()},
 	}
 
+	return pollToken(ctx, config, payload, timeout, interval, nil)
+}
+
+// tokenErrorResponse is the error response of the token endpoint.
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// pollToken polls the token endpoint with the payload of a decoupled grant, such as the device
+// code or CIBA grant, until the user authorized the request or the timeout expired. The token
+// endpoint is polled every interval, or after a notification on wake if it is not nil, in which
+// case polling every interval is the fallback for a lost notification. Only authorization_pending
+// and slow_down are retried; any other error ends the polling, classified like the errors of
+// requestToken, e.g. ErrHTTPFailure for server errors.
+func pollToken(ctx context.Context, config Config, payload url.Values, timeout time.Duration, interval time.Duration, wake <-chan struct{}) (*AccessTokenResponse, error) {
+	payload.Set("client_id", config.ClientId)
 	if config.ClientSecret != "" {
 		payload.Set("client_secret", config.ClientSecret)
 	}
@@ -35,47 +54,63 @@ func PollForAccessToken(ctx context.Context, config Config, deviceCode string, t
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	var resp *http.Response
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("%w: timed out waiting for user authorization", ErrTokenExpired)
-		default:
-			// Create HTTP request
-			req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenEndpoint, bytes.NewBufferString(payload.Encode()))
-			if err != nil {
-				return nil, fmt.Errorf("%w: failed to create HTTP request", ErrInternal)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 || wake != nil {
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%w: timed out waiting for user authorization", ErrTokenExpired)
+			case <-time.After(interval):
+			case <-wake:
 			}
-
-			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-			resp, err = client.Do(req)
-			if err != nil {
-				return nil, fmt.Errorf("%w: %v", ErrHTTPFailure, err)
-			}
-			defer resp.Body.Close()
 		}
 
-		if resp.StatusCode == http.StatusOK {
-			break
+		tokenResponse, err := pollTokenOnce(ctx, client, config, payload)
+		switch {
+		case err == nil:
+			return tokenResponse, nil
+		case ctx.Err() != nil:
+			return nil, fmt.Errorf("%w: timed out waiting for user authorization", ErrTokenExpired)
+		case errors.Is(err, ErrSlowDown):
+			interval += 5 * time.Second
+		case errors.Is(err, ErrAuthorizationPending):
+		default:
+			return nil, err
 		}
+	}
+}
 
-		time.Sleep(interval)
+// pollTokenOnce requests the token of a decoupled grant from the token endpoint.
+func pollTokenOnce(ctx context.Context, client *http.Client, config Config, payload url.Values) (*AccessTokenResponse, error) {
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenEndpoint, bytes.NewBufferString(payload.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create HTTP request", ErrInternal)
 	}
 
-	// Check HTTP status code
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHTTPFailure, err)
+	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		switch resp.StatusCode {
-		case http.StatusBadRequest:
-			return nil, fmt.Errorf("%w: %s", ErrInvalidTokenResponse, string(body))
-		case http.StatusUnauthorized:
-			return nil, fmt.Errorf("%w: %s", ErrAuthorizationPending, string(body))
-		case http.StatusForbidden:
-			return nil, fmt.Errorf("%w: %s", ErrSlowDown, string(body))
+
+		var errorResponse tokenErrorResponse
+		_ = json.Unmarshal(body, &errorResponse)
+		switch errorResponse.Error {
+		case "authorization_pending":
+			return nil, ErrAuthorizationPending
+		case "slow_down":
+			return nil, ErrSlowDown
+		case "access_denied":
+			return nil, fmt.Errorf("%w: %s", ErrUserDenied, errorResponse.ErrorDescription)
+		case "expired_token":
+			return nil, fmt.Errorf("%w: the authorization request expired", ErrTokenExpired)
 		default:
-			fmt.Printf("url: %s", config.TokenEndpoint)
-			return nil, fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, string(body))
+			return nil, tokenEndpointError(resp.StatusCode, body)
 		}
 	}
 
@@ -85,5 +120,87 @@ func PollForAccessToken(ctx context.Context, config Config, deviceCode string, t
 		return nil, fmt.Errorf("%w: failed to parse response body", ErrInternal)
 	}
 
+	if tokenResponse.AccessToken == "" {
+		return nil, fmt.Errorf("%w: missing access_token", ErrInvalidResponse)
+	}
+
 	return &tokenResponse, nil
 }
+
+// RefreshAccessToken uses a refresh token to obtain a new access token. If resources are given,
+// the new access token is restricted to them (RFC 8707).
+func RefreshAccessToken(ctx context.Context, config Config, refreshToken string, resources []string) (*AccessTokenResponse, error) {
+	payload := url.Values{
+		"grant_type":    []string{RefreshToken.String()},
+		"refresh_token": []string{refreshToken},
+	}
+
+	// Add optional resource indicators
+	for _, resource := range resources {
+		payload.Add("resource", resource)
+	}
+
+	return requestToken(ctx, config, payload)
+}
+
+// requestToken posts the given payload to the token endpoint and decodes the token response.
+func requestToken(ctx context.Context, config Config, payload url.Values) (*AccessTokenResponse, error) {
+	payload.Set("client_id", config.ClientId)
+	if config.ClientSecret != "" {
+		payload.Set("client_secret", config.ClientSecret)
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenEndpoint, bytes.NewBufferString(payload.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create HTTP request", ErrInternal)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Execute the HTTP request
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHTTPFailure, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, tokenEndpointError(resp.StatusCode, body)
+	}
+
+	// Parse the response body
+	var tokenResponse AccessTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse response body", ErrInternal)
+	}
+
+	if tokenResponse.AccessToken == "" {
+		return nil, fmt.Errorf("%w: missing access_token", ErrInvalidResponse)
+	}
+
+	return &tokenResponse, nil
+}
+
+// tokenEndpointError returns the error for an error response of the token endpoint, based on
+// the error code of the OAuth 2.0 error response (RFC 6749, section 5.2). Only invalid_grant,
+// i.e. a refresh token or grant that is no longer valid, means that the user has to log in again.
+func tokenEndpointError(status int, body []byte) error {
+	var errorResponse tokenErrorResponse
+	_ = json.Unmarshal(body, &errorResponse)
+
+	switch errorResponse.Error {
+	case "invalid_grant":
+		return fmt.Errorf("%w: %s", ErrInvalidTokenResponse, errorResponse.ErrorDescription)
+	case "invalid_scope", "invalid_target":
+		return fmt.Errorf("%w: token endpoint returned %s: %s", ErrInvalidScope, errorResponse.Error, errorResponse.ErrorDescription)
+	case "invalid_request", "invalid_client", "unauthorized_client", "unsupported_grant_type":
+		return fmt.Errorf("%w: token endpoint returned %s: %s", ErrInvalidConfig, errorResponse.Error, errorResponse.ErrorDescription)
+	}
+
+	if status >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: unexpected HTTP status %d: %s", ErrHTTPFailure, status, string(body))
+	}
+	return fmt.Errorf("%w: unexpected HTTP status %d: %s", ErrInvalidResponse, status, string(body))
+}
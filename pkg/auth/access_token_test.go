@@ -5,6 +5,8 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -26,8 +28,68 @@ func TestPollForAccessToken(t *testing.T) {
 			name:           "BadRequest",
 			serverResponse: `{"error":"invalid_request"}`,
 			serverStatus:   http.StatusBadRequest,
+			expectedError:  ErrInvalidConfig,
+		},
+		{
+			name:           "InvalidClient",
+			serverResponse: `{"error":"invalid_client"}`,
+			serverStatus:   http.StatusUnauthorized,
+			expectedError:  ErrInvalidConfig,
+		},
+		{
+			name:           "UnauthorizedClient",
+			serverResponse: `{"error":"unauthorized_client"}`,
+			serverStatus:   http.StatusBadRequest,
+			expectedError:  ErrInvalidConfig,
+		},
+		{
+			name:           "UnsupportedGrantType",
+			serverResponse: `{"error":"unsupported_grant_type"}`,
+			serverStatus:   http.StatusBadRequest,
+			expectedError:  ErrInvalidConfig,
+		},
+		{
+			name:           "InvalidGrant",
+			serverResponse: `{"error":"invalid_grant"}`,
+			serverStatus:   http.StatusBadRequest,
+			expectedError:  ErrInvalidTokenResponse,
+		},
+		{
+			name:           "UnknownError",
+			serverResponse: `{"error":"unknown"}`,
+			serverStatus:   http.StatusBadRequest,
+			expectedError:  ErrInvalidResponse,
+		},
+		{
+			name:           "ServerError",
+			serverResponse: `{"error":"server_error"}`,
+			serverStatus:   http.StatusInternalServerError,
+			expectedError:  ErrHTTPFailure,
+		},
+		{
+			name:           "BadGateway",
+			serverResponse: `<html>Bad Gateway</html>`,
+			serverStatus:   http.StatusBadGateway,
+			expectedError:  ErrHTTPFailure,
+		},
+		{
+			name:           "MissingAccessToken",
+			serverResponse: `{"token_type":"bearer"}`,
+			serverStatus:   http.StatusOK,
+			expectedError:  ErrInvalidResponse,
+		},
+		{
+			name:           "ExpiredToken",
+			serverResponse: `{"error":"expired_token"}`,
+			serverStatus:   http.StatusBadRequest,
 			expectedError:  ErrTokenExpired,
 		},
+		{
+			name:           "AccessDenied",
+			serverResponse: `{"error":"access_denied"}`,
+			serverStatus:   http.StatusBadRequest,
+			expectedError:  ErrUserDenied,
+		},
 	}
 
 	for _, tt := range tests {
@@ -51,7 +113,11 @@ func TestPollForAccessToken(t *testing.T) {
 			timeout := 5 * time.Second
 			interval := 1 * time.Second
 
+			start := time.Now()
 			_, err := PollForAccessToken(ctx, config, deviceCode, timeout, interval)
+			if elapsed := time.Since(start); elapsed >= interval {
+				t.Fatalf("expected the first response to end polling, polled for %s", elapsed)
+			}
 			if err != nil && tt.expectedError == nil {
 				t.Fatalf("expected no error, got %v", err)
 			}
@@ -64,3 +130,84 @@ func TestPollForAccessToken(t *testing.T) {
 		})
 	}
 }
+
+func TestPollTokenRetriesPendingAuthorization(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if polls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"authorization_pending"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"test_token","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer server.Close()
+
+	config := Config{ClientId: "test_client_id", TokenEndpoint: server.URL}
+
+	response, err := PollForAccessToken(context.Background(), config, "test_device_code", 5*time.Second, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if response.AccessToken != "test_token" || polls.Load() != 3 {
+		t.Fatalf("expected test_token after 3 polls, got %q after %d polls", response.AccessToken, polls.Load())
+	}
+}
+
+func TestPollTokenFallsBackToIntervalWithoutNotification(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"test_token","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer server.Close()
+
+	config := Config{ClientId: "test_client_id", TokenEndpoint: server.URL}
+
+	// The notification is lost, so the token endpoint is polled after the interval
+	wake := make(chan struct{})
+	response, err := pollToken(context.Background(), config, url.Values{}, 5*time.Second, 10*time.Millisecond, wake)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if response.AccessToken != "test_token" {
+		t.Fatalf("expected test_token, got %q", response.AccessToken)
+	}
+}
+
+func TestRefreshAccessTokenErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverStatus  int
+		response      string
+		expectedError error
+		loginRequired bool
+	}{
+		{name: "InvalidGrant", serverStatus: http.StatusBadRequest, response: `{"error":"invalid_grant"}`, expectedError: ErrInvalidTokenResponse, loginRequired: true},
+		{name: "InvalidTarget", serverStatus: http.StatusBadRequest, response: `{"error":"invalid_target"}`, expectedError: ErrInvalidScope},
+		{name: "InvalidScope", serverStatus: http.StatusBadRequest, response: `{"error":"invalid_scope"}`, expectedError: ErrInvalidScope},
+		{name: "InvalidClient", serverStatus: http.StatusUnauthorized, response: `{"error":"invalid_client"}`, expectedError: ErrInvalidConfig},
+		{name: "UnauthorizedClient", serverStatus: http.StatusBadRequest, response: `{"error":"unauthorized_client"}`, expectedError: ErrInvalidConfig},
+		{name: "UnknownError", serverStatus: http.StatusBadRequest, response: `{"error":"unknown"}`, expectedError: ErrInvalidResponse},
+		{name: "ServerError", serverStatus: http.StatusBadGateway, response: `<html>Bad Gateway</html>`, expectedError: ErrHTTPFailure},
+		{name: "MissingAccessToken", serverStatus: http.StatusOK, response: `{"token_type":"bearer"}`, expectedError: ErrInvalidResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.serverStatus)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			config := Config{ClientId: "test_client_id", TokenEndpoint: server.URL}
+
+			_, err := RefreshAccessToken(context.Background(), config, "refresh_token", []string{"https://api.example.com"})
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if loginRequired(err) != tt.loginRequired {
+				t.Fatalf("expected loginRequired to be %t for %v", tt.loginRequired, err)
+			}
+		})
+	}
+}
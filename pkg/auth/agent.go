@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// NewAgentCommand creates a command that runs the token agent. Like ssh-agent, the agent keeps
+// the tokens in memory, refreshes the login token in the background and serves the tokens to
+// other invocations of the CLI over a Unix socket that only the current user can access.
+// Commands use the agent when they are configured with WithAgent or WithAgentSocket.
+func NewAgentCommand(options ...Option) *cobra.Command {
+	var socket string
+
+	cmd := &cobra.Command{
+		Use:         "agent",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Run a token agent that serves tokens to other commands.",
+		Long: `The "agent" command keeps your tokens in memory and serves them to other invocations
+of the CLI over a Unix socket, so that the token storage is only accessed once. The login
+token is refreshed in the background while the agent is running.
+
+The socket is only accessible by the current user, and connections of processes running as
+other users are rejected. Stop the agent with Ctrl+C.
+`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, err := configureBacking(cmd.Context(), options...)
+			if err != nil {
+				return commandError("failed to configure auth", err)
+			}
+
+			if socket == "" {
+				socket = authConfig.agentSocketPath()
+			}
+
+			listener, err := storage.ListenAgent(socket)
+			if err != nil {
+				return commandError("failed to start agent", err)
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			cached := storage.NewCachedStorage(authConfig.StorageProvider)
+			authConfig.StorageProvider = cached
+
+			// Clients store the tokens of a profile under its key, so refresh them there
+			if err := authConfig.applyProfileStorage(); err != nil {
+				return commandError("failed to configure auth", err)
+			}
+
+			manager := newTokenManager(*authConfig, "")
+			go func() {
+				_ = manager.Run(ctx)
+			}()
+
+			server := storage.NewAgentServer(cached)
+			server.OnChange = func(key string) {
+				if key == authConfig.tokenStorageKey() {
+					manager.Reset()
+				}
+			}
+
+			cmd.Println("Agent listening on", socket)
+
+			if err := server.Serve(ctx, listener); err != nil {
+				return commandError("failed to serve agent", err)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&socket, "socket", "", "path of the agent socket")
+
+	return cmd
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureWithAgent(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent", "agent.sock")
+	options := []Option{
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(storage.NewMemoryStorage("client")),
+		WithAgentSocket(socket),
+	}
+
+	// Without a running agent the configured storage provider is used
+	authConfig, err := configure(options...)
+	assert.NoError(t, err)
+	_, err = LoadTokenSet(authConfig.StorageProvider)
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	agentStorage := storage.NewMemoryStorage("agent")
+	assert.NoError(t, SaveTokenSet(agentStorage, TokenSet{AccessToken: "agent_token", Expiry: time.Now().Add(time.Hour)}))
+
+	listener, err := storage.ListenAgent(socket)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- storage.NewAgentServer(agentStorage).Serve(ctx, listener)
+	}()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	authConfig, err = configure(options...)
+	assert.NoError(t, err)
+
+	tokenSet, err := FetchResourceToken(context.Background(), *authConfig, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "agent_token", tokenSet.AccessToken)
+}
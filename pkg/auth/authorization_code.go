@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AuthorizationRequest holds the per-attempt parameters of an authorization code flow.
+type AuthorizationRequest struct {
+	RedirectURI  string
+	State        string
+	CodeVerifier string
+}
+
+// PushedAuthorizationResponse holds the response from the pushed authorization request endpoint.
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// NewAuthorizationRequest creates an authorization request with a random state and PKCE code verifier.
+func NewAuthorizationRequest(redirectURI string) (*AuthorizationRequest, error) {
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	codeVerifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthorizationRequest{
+		RedirectURI:  redirectURI,
+		State:        state,
+		CodeVerifier: codeVerifier,
+	}, nil
+}
+
+// CodeChallenge returns the S256 PKCE code challenge for the request's code verifier.
+func (r AuthorizationRequest) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(r.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// parameters returns the authorization request parameters for the given config.
+func (r AuthorizationRequest) parameters(config Config) url.Values {
+	params := url.Values{
+		"response_type":         []string{"code"},
+		"client_id":             []string{config.ClientId},
+		"redirect_uri":          []string{r.RedirectURI},
+		"scope":                 []string{joinScopes(config.Scopes)},
+		"state":                 []string{r.State},
+		"code_challenge":        []string{r.CodeChallenge()},
+		"code_challenge_method": []string{"S256"},
+	}
+
+	// Add optional audience
+	if config.Audience != "" {
+		params.Set("audience", config.Audience)
+	}
+
+	// Add optional resource indicators
+	for _, resource := range config.Resources {
+		params.Add("resource", resource)
+	}
+
+	return params
+}
+
+// PushAuthorizationRequest posts the authorization request parameters to the pushed authorization
+// request endpoint (RFC 9126) and returns the request_uri that references them.
+func PushAuthorizationRequest(ctx context.Context, config Config, params url.Values) (*PushedAuthorizationResponse, error) {
+	payload := url.Values{}
+	for key, values := range params {
+		payload[key] = values
+	}
+	payload.Set("client_id", config.ClientId)
+
+	// Add optional client secret
+	if config.ClientSecret != "" {
+		payload.Set("client_secret", config.ClientSecret)
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.PushedAuthorizationRequestEndpoint, bytes.NewBufferString(payload.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create HTTP request", ErrInternal)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Execute the HTTP request
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHTTPFailure, err)
+	}
+	defer resp.Body.Close()
+
+	// The specification mandates 201 Created, but some providers answer with 200 OK
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		switch resp.StatusCode {
+		case http.StatusBadRequest:
+			return nil, fmt.Errorf("%w: pushed authorization request rejected: %s", ErrInvalidResponse, string(body))
+		case http.StatusUnauthorized:
+			return nil, fmt.Errorf("%w: invalid client ID or secret", ErrInvalidConfig)
+		default:
+			return nil, fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, string(body))
+		}
+	}
+
+	// Parse the response body
+	var pushed PushedAuthorizationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pushed); err != nil {
+		return nil, errors.Join(fmt.Errorf("%w: failed to decode response body", ErrInvalidResponse), err)
+	}
+
+	if pushed.RequestURI == "" {
+		return nil, fmt.Errorf("%w: missing request_uri", ErrMissingResponseData)
+	}
+
+	return &pushed, nil
+}
+
+// BuildAuthorizationURL returns the URL the user has to visit to authorize the request.
+// If pushed authorization requests are enabled, the parameters are pushed first and the URL
+// carries only the client_id and the returned request_uri.
+func BuildAuthorizationURL(ctx context.Context, config Config, request AuthorizationRequest) (string, error) {
+	authorizationURL, err := url.Parse(config.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid authorization endpoint", ErrInvalidConfig)
+	}
+
+	params := request.parameters(config)
+	if config.UsePushedAuthorizationRequests {
+		pushed, err := PushAuthorizationRequest(ctx, config, params)
+		if err != nil {
+			return "", err
+		}
+
+		params = url.Values{
+			"client_id":   []string{config.ClientId},
+			"request_uri": []string{pushed.RequestURI},
+		}
+	}
+
+	// Keep query parameters that are part of the configured endpoint
+	query := authorizationURL.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	authorizationURL.RawQuery = query.Encode()
+
+	return authorizationURL.String(), nil
+}
+
+// ExchangeAuthorizationCode exchanges an authorization code for an access token.
+func ExchangeAuthorizationCode(ctx context.Context, config Config, request AuthorizationRequest, code string) (*AccessTokenResponse, error) {
+	payload := url.Values{
+		"grant_type":    []string{AuthorizationCode.String()},
+		"code":          []string{code},
+		"redirect_uri":  []string{request.RedirectURI},
+		"code_verifier": []string{request.CodeVerifier},
+	}
+
+	// Add optional resource indicators
+	for _, resource := range config.Resources {
+		payload.Add("resource", resource)
+	}
+
+	return requestToken(ctx, config, payload)
+}
+
+// FetchAuthorizationCodeToken runs the authorization code flow with PKCE. It listens on the loopback
+// redirect URI, passes the authorization URL to open and exchanges the code that is returned to the
+// redirect URI for an access token.
+func FetchAuthorizationCodeToken(ctx context.Context, config Config, open func(authorizationURL string)) (*AccessTokenResponse, error) {
+	listener, redirectURI, err := listenLoopback(config.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	request, err := NewAuthorizationRequest(redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizationURL, err := BuildAuthorizationURL(ctx, config, *request)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := awaitLoopbackCallback(ctx, listener, "Authentication", request.State, func(query url.Values) (string, error) {
+		return parseAuthorizationResponse(query, request.State)
+	}, func() {
+		open(authorizationURL)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ExchangeAuthorizationCode(ctx, config, *request, code)
+}
+
+// awaitLoopbackCallback serves the loopback listener, calls open once it is ready and waits up to
+// DefaultTimeout for the browser to be redirected to the callback path with the given state. It
+// returns the result of parse for the query of the redirect. Requests with another state, e.g.
+// from other local processes, are rejected without ending the wait. action names the step in the
+// page shown in the browser.
+func awaitLoopbackCallback(ctx context.Context, listener *loopbackListener, action string, state string, parse func(query url.Values) (string, error), open func()) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	results := make(chan string, 1)
+	errs := make(chan error, 1)
+
+	callbackPath := listener.callbackPath
+	server := &http.Server{
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != callbackPath {
+				http.NotFound(w, r)
+				return
+			}
+
+			if r.URL.Query().Get("state") != state {
+				http.Error(w, "Invalid state.", http.StatusBadRequest)
+				return
+			}
+
+			result, err := parse(r.URL.Query())
+			if err != nil {
+				http.Error(w, action+" failed. You can close this window.", http.StatusBadRequest)
+				select {
+				case errs <- err:
+				default:
+				}
+				return
+			}
+
+			_, _ = io.WriteString(w, action+" successful. You can close this window.")
+			select {
+			case results <- result:
+			default:
+			}
+		}),
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+
+	open()
+
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("%w: timed out waiting for the browser", ErrTokenExpired)
+	case err := <-errs:
+		return "", err
+	case result := <-results:
+		return result, nil
+	}
+}
+
+// parseAuthorizationResponse validates the query of the redirect and returns the authorization code.
+func parseAuthorizationResponse(query url.Values, state string) (string, error) {
+	if query.Get("state") != state {
+		return "", fmt.Errorf("%w: state mismatch in authorization response", ErrInvalidResponse)
+	}
+
+	if errorCode := query.Get("error"); errorCode != "" {
+		if errorCode == "access_denied" {
+			return "", ErrUserDenied
+		}
+		return "", fmt.Errorf("%w: %s: %s", ErrInvalidResponse, errorCode, query.Get("error_description"))
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("%w: missing code", ErrMissingResponseData)
+	}
+
+	return code, nil
+}
+
+// loopbackListener is a listener for the redirect of the authorization code flow.
+type loopbackListener struct {
+	net.Listener
+	callbackPath string
+}
+
+// listenLoopback starts listening on the host and port of the redirect URI and returns the
+// redirect URI with the port that was actually bound.
+func listenLoopback(redirectURI string) (*loopbackListener, string, error) {
+	if redirectURI == "" {
+		redirectURI = DefaultRedirectURI
+	}
+
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: invalid redirect URI", ErrInvalidConfig)
+	}
+
+	// Only loopback interfaces are bound, so the redirect cannot be received from the network
+	switch u.Hostname() {
+	case "127.0.0.1", "::1", "localhost":
+	default:
+		return nil, "", fmt.Errorf("%w: redirect URI %s is not a loopback address", ErrInvalidConfig, redirectURI)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "0"
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: failed to listen on redirect URI: %v", ErrInternal, err)
+	}
+
+	u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(listener.Addr().(*net.TCPAddr).Port))
+
+	callbackPath := u.Path
+	if callbackPath == "" {
+		callbackPath = "/"
+	}
+
+	return &loopbackListener{Listener: listener, callbackPath: callbackPath}, u.String(), nil
+}
+
+// randomString returns a URL-safe random string generated from n random bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w: failed to generate random data", ErrInternal)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushAuthorizationRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_id", r.PostForm.Get("client_id"))
+		assert.Equal(t, "client_secret", r.PostForm.Get("client_secret"))
+		assert.Equal(t, "code", r.PostForm.Get("response_type"))
+
+		w.WriteHeader(http.StatusCreated)
+		if _, err := w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:abc","expires_in":60}`)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	config := Config{
+		ClientId:                           "client_id",
+		ClientSecret:                       "client_secret",
+		PushedAuthorizationRequestEndpoint: server.URL,
+	}
+
+	pushed, err := PushAuthorizationRequest(context.Background(), config, url.Values{"response_type": []string{"code"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "urn:ietf:params:oauth:request_uri:abc", pushed.RequestURI)
+	assert.Equal(t, 60, pushed.ExpiresIn)
+}
+
+func TestBuildAuthorizationURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		if _, err := w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:abc","expires_in":60}`)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	request := AuthorizationRequest{
+		RedirectURI:  "http://127.0.0.1:8080/callback",
+		State:        "state",
+		CodeVerifier: "verifier",
+	}
+
+	t.Run("without pushed authorization requests", func(t *testing.T) {
+		config := Config{
+			ClientId:              "client_id",
+			AuthorizationEndpoint: "https://example.com/authorize",
+			Scopes:                []string{"openid", "profile"},
+		}
+
+		authorizationURL, err := BuildAuthorizationURL(context.Background(), config, request)
+		assert.NoError(t, err)
+
+		u, err := url.Parse(authorizationURL)
+		assert.NoError(t, err)
+		assert.Equal(t, "client_id", u.Query().Get("client_id"))
+		assert.Equal(t, "openid profile", u.Query().Get("scope"))
+		assert.Equal(t, "state", u.Query().Get("state"))
+		assert.Equal(t, request.CodeChallenge(), u.Query().Get("code_challenge"))
+		assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+		assert.Empty(t, u.Query().Get("request_uri"))
+	})
+
+	t.Run("with pushed authorization requests", func(t *testing.T) {
+		config := Config{
+			ClientId:                           "client_id",
+			AuthorizationEndpoint:              "https://example.com/authorize",
+			PushedAuthorizationRequestEndpoint: server.URL,
+			UsePushedAuthorizationRequests:     true,
+			Scopes:                             []string{"openid"},
+		}
+
+		authorizationURL, err := BuildAuthorizationURL(context.Background(), config, request)
+		assert.NoError(t, err)
+
+		u, err := url.Parse(authorizationURL)
+		assert.NoError(t, err)
+		assert.Equal(t, url.Values{
+			"client_id":   []string{"client_id"},
+			"request_uri": []string{"urn:ietf:params:oauth:request_uri:abc"},
+		}, u.Query())
+	})
+}
+
+func TestFetchAuthorizationCodeToken(t *testing.T) {
+	var pushed url.Values
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/par", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		pushed = r.PostForm
+		w.WriteHeader(http.StatusCreated)
+		if _, err := w.Write([]byte(`{"request_uri":"urn:example:request","expires_in":60}`)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:example:request", r.URL.Query().Get("request_uri"))
+		redirectURI := pushed.Get("redirect_uri") + "?code=test_code&state=" + url.QueryEscape(pushed.Get("state"))
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "test_code", r.PostForm.Get("code"))
+		assert.Equal(t, pushed.Get("redirect_uri"), r.PostForm.Get("redirect_uri"))
+
+		challenge := AuthorizationRequest{CodeVerifier: r.PostForm.Get("code_verifier")}.CodeChallenge()
+		assert.Equal(t, pushed.Get("code_challenge"), challenge)
+
+		if _, err := w.Write([]byte(`{"access_token":"test_token","token_type":"bearer","expires_in":3600}`)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	config := Config{
+		ClientId:                           "client_id",
+		AuthorizationEndpoint:              server.URL + "/authorize",
+		PushedAuthorizationRequestEndpoint: server.URL + "/par",
+		TokenEndpoint:                      server.URL + "/token",
+		UsePushedAuthorizationRequests:     true,
+		Scopes:                             []string{"openid"},
+	}
+
+	token, err := FetchAuthorizationCodeToken(context.Background(), config, func(authorizationURL string) {
+		go func() {
+			resp, err := http.Get(authorizationURL)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "test_token", token.AccessToken)
+}
+
+func TestParseAuthorizationResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         url.Values
+		expectedCode  string
+		expectedError error
+	}{
+		{
+			name:         "valid response",
+			query:        url.Values{"code": []string{"abc"}, "state": []string{"state"}},
+			expectedCode: "abc",
+		},
+		{
+			name:          "state mismatch",
+			query:         url.Values{"code": []string{"abc"}, "state": []string{"other"}},
+			expectedError: ErrInvalidResponse,
+		},
+		{
+			name:          "access denied",
+			query:         url.Values{"error": []string{"access_denied"}, "state": []string{"state"}},
+			expectedError: ErrUserDenied,
+		},
+		{
+			name:          "missing code",
+			query:         url.Values{"state": []string{"state"}},
+			expectedError: ErrMissingResponseData,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := parseAuthorizationResponse(tt.query, "state")
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCode, code)
+		})
+	}
+}
+
+func TestListenLoopback(t *testing.T) {
+	for _, redirectURI := range []string{"http://127.0.0.1/callback", "http://localhost/callback"} {
+		listener, bound, err := listenLoopback(redirectURI)
+		if assert.NoError(t, err, redirectURI) {
+			assert.NotEqual(t, redirectURI, bound)
+			listener.Close()
+		}
+	}
+
+	for _, redirectURI := range []string{"http://0.0.0.0/callback", "http://example.com/callback", "http://192.168.1.1/callback"} {
+		_, _, err := listenLoopback(redirectURI)
+		assert.ErrorIs(t, err, ErrInvalidConfig, redirectURI)
+	}
+}
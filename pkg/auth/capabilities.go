@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// checkCapabilities compares the configuration with the capabilities that the provider
+// advertises in its metadata, so that a misconfiguration is reported before a flow is started.
+// Grant types, PKCE methods and client authentication methods that are not supported are
+// errors, since the flow would fail. Scopes that are not advertised are warnings, since
+// providers may omit scopes from scopes_supported; they are reported to the warning handler or
+// written to warnings. Capabilities that the provider does not advertise are not checked.
+func (c Config) checkCapabilities(warnings io.Writer) error {
+	metadata := c.metadata
+	if metadata == nil {
+		return nil
+	}
+
+	if c.GrantType != "" && len(metadata.GrantTypesSupported) > 0 && !slices.Contains(metadata.GrantTypesSupported, c.GrantType.String()) {
+		return fmt.Errorf("%w: provider does not support the %s grant", ErrInvalidConfig, grantTypeName(c.GrantType))
+	}
+
+	if c.GrantType == AuthorizationCode && len(metadata.CodeChallengeMethodsSupported) > 0 && !slices.Contains(metadata.CodeChallengeMethodsSupported, "S256") {
+		return fmt.Errorf("%w: provider does not support the S256 code challenge method (PKCE)", ErrInvalidConfig)
+	}
+
+	if c.GrantType == CIBA && len(metadata.BackchannelTokenDeliveryModesSupported) > 0 && !slices.Contains(metadata.BackchannelTokenDeliveryModesSupported, c.backchannelTokenDeliveryMode()) {
+		return fmt.Errorf("%w: provider does not support the %s token delivery mode", ErrInvalidConfig, c.backchannelTokenDeliveryMode())
+	}
+
+	if c.ClientSecret != "" && len(metadata.TokenEndpointAuthMethodsSupported) > 0 && !slices.Contains(metadata.TokenEndpointAuthMethodsSupported, "client_secret_post") {
+		return fmt.Errorf("%w: provider does not support the client_secret_post client authentication", ErrInvalidConfig)
+	}
+
+	if len(metadata.ScopesSupported) > 0 {
+		for _, scope := range c.Scopes {
+			if !slices.Contains(metadata.ScopesSupported, scope) {
+				c.warn(warnings, fmt.Sprintf("scope %s is not supported by the provider", scope))
+			}
+		}
+	}
+
+	return nil
+}
+
+// warn reports a warning about the configuration to the warning handler, or writes it to out.
+func (c Config) warn(out io.Writer, warning string) {
+	if c.WarningHandler != nil {
+		c.WarningHandler(warning)
+		return
+	}
+	fmt.Fprintln(out, "Warning:", warning)
+}
+
+// grantTypeName returns the short name of the grant type, e.g. "device_code".
+func grantTypeName(grantType GrantType) string {
+	for name, g := range grantTypeNames {
+		if g == grantType {
+			return name
+		}
+	}
+	return grantType.String()
+}
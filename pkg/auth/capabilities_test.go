@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCapabilities(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Config
+		metadata     AuthorizationServerMetadataResponse
+		wantErr      string
+		wantWarnings []string
+	}{
+		{
+			name:     "nothing advertised",
+			config:   Config{GrantType: DeviceCode, Scopes: []string{"openid"}, ClientSecret: "secret"},
+			metadata: AuthorizationServerMetadataResponse{},
+		},
+		{
+			name:   "supported",
+			config: Config{GrantType: AuthorizationCode, Scopes: []string{"openid"}, ClientSecret: "secret"},
+			metadata: AuthorizationServerMetadataResponse{
+				GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+				CodeChallengeMethodsSupported:     []string{"plain", "S256"},
+				TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+				ScopesSupported:                   []string{"openid", "profile"},
+			},
+		},
+		{
+			name:     "unsupported grant type",
+			config:   Config{GrantType: DeviceCode},
+			metadata: AuthorizationServerMetadataResponse{GrantTypesSupported: []string{"authorization_code"}},
+			wantErr:  "provider does not support the device_code grant",
+		},
+		{
+			name:     "unsupported code challenge method",
+			config:   Config{GrantType: AuthorizationCode},
+			metadata: AuthorizationServerMetadataResponse{CodeChallengeMethodsSupported: []string{"plain"}},
+			wantErr:  "provider does not support the S256 code challenge method",
+		},
+		{
+			name:     "unsupported client authentication",
+			config:   Config{GrantType: ClientCredentials, ClientSecret: "secret"},
+			metadata: AuthorizationServerMetadataResponse{TokenEndpointAuthMethodsSupported: []string{"private_key_jwt"}},
+			wantErr:  "provider does not support the client_secret_post client authentication",
+		},
+		{
+			name:         "unsupported scopes",
+			config:       Config{GrantType: DeviceCode, Scopes: []string{"openid", "offline_access", "email"}},
+			metadata:     AuthorizationServerMetadataResponse{ScopesSupported: []string{"openid"}},
+			wantWarnings: []string{"scope offline_access is not supported by the provider", "scope email is not supported by the provider"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings []string
+			tt.config.WarningHandler = func(warning string) {
+				warnings = append(warnings, warning)
+			}
+			tt.config.metadata = &tt.metadata
+
+			err := tt.config.checkCapabilities(io.Discard)
+			if tt.wantErr != "" {
+				assert.ErrorIs(t, err, ErrInvalidConfig)
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantWarnings, warnings)
+		})
+	}
+}
+
+func TestLoginChecksCapabilities(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			assert.NoError(t, json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"}))
+			return
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(AuthorizationServerMetadataResponse{
+			Issuer:                server.URL,
+			AuthorizationEndpoint: server.URL + "/authorize",
+			TokenEndpoint:         server.URL + "/token",
+			GrantTypesSupported:   []string{"authorization_code", "client_credentials", "refresh_token"},
+			ScopesSupported:       []string{"openid"},
+		}))
+	}))
+	defer server.Close()
+
+	login := func(options ...Option) (string, error) {
+		options = append([]Option{
+			WithIssuer(server.URL),
+			WithClientID("client_id"),
+			WithScopes([]string{"openid", "email"}),
+			WithStorageProvider(storage.NewMemoryStorage("test")),
+		}, options...)
+
+		_, err := configure(options...)
+		require.NoError(t, err, "capabilities are only checked when a flow starts")
+
+		var out bytes.Buffer
+		cmd := NewLoginCommand(options...)
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&out)
+		cmd.SetArgs(nil)
+		err = cmd.Execute()
+		return out.String(), err
+	}
+
+	t.Run("unsupported grant type", func(t *testing.T) {
+		_, err := login()
+		assert.ErrorContains(t, err, "provider does not support the device_code grant")
+		assert.Equal(t, ExitCodeConfig, ExitCode(err))
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		out, err := login(WithGrantType(ClientCredentials), WithClientSecret("secret"))
+		assert.Error(t, err)
+		assert.Equal(t, 1, strings.Count(out, "Warning: scope email is not supported by the provider"))
+	})
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// BackchannelTokenDeliveryPoll polls the token endpoint until the user approved the CIBA
+	// request.
+	BackchannelTokenDeliveryPoll = "poll"
+	// BackchannelTokenDeliveryPing waits for a notification of the provider on the client
+	// notification endpoint before the token is requested.
+	BackchannelTokenDeliveryPing = "ping"
+
+	// defaultBackchannelInterval is the polling interval of the CIBA grant if the provider does
+	// not return one.
+	defaultBackchannelInterval = 5 * time.Second
+)
+
+// BackchannelAuthResponse holds the response from the backchannel authentication endpoint.
+type BackchannelAuthResponse struct {
+	AuthReqID string `json:"auth_req_id"`
+	ExpiresIn int    `json:"expires_in"`
+	Interval  int    `json:"interval,omitempty"`
+}
+
+// WithBackchannelAuthenticationEndpoint sets the backchannel authentication endpoint of the CIBA
+// grant. It is discovered from the metadata of the issuer if not set.
+func WithBackchannelAuthenticationEndpoint(backchannelAuthenticationEndpoint string) Option {
+	return func(c *Config) {
+		c.BackchannelAuthenticationEndpoint = backchannelAuthenticationEndpoint
+	}
+}
+
+// WithLoginHint sets the user that is asked for approval by the CIBA grant, e.g. an email address.
+func WithLoginHint(loginHint string) Option {
+	return func(c *Config) {
+		c.LoginHint = loginHint
+	}
+}
+
+// WithBindingMessage sets the message that is shown by the CLI and on the device of the user by
+// the CIBA grant.
+func WithBindingMessage(bindingMessage string) Option {
+	return func(c *Config) {
+		c.BindingMessage = bindingMessage
+	}
+}
+
+// WithBackchannelPing uses the ping mode of the CIBA grant. The CLI listens on the loopback
+// client notification endpoint, which must be registered with the provider, and requests the
+// token once the provider notifies it.
+func WithBackchannelPing(clientNotificationEndpoint string) Option {
+	return func(c *Config) {
+		c.BackchannelTokenDeliveryMode = BackchannelTokenDeliveryPing
+		c.BackchannelClientNotificationEndpoint = clientNotificationEndpoint
+	}
+}
+
+// backchannelTokenDeliveryMode returns the configured token delivery mode of the CIBA grant.
+func (c Config) backchannelTokenDeliveryMode() string {
+	if c.BackchannelTokenDeliveryMode == "" {
+		return BackchannelTokenDeliveryPoll
+	}
+	return c.BackchannelTokenDeliveryMode
+}
+
+// RequestBackchannelAuthentication starts a CIBA request for the user of the login hint. In ping
+// mode, the client notification token authorizes the notification of the provider.
+func RequestBackchannelAuthentication(ctx context.Context, config Config, clientNotificationToken string) (*BackchannelAuthResponse, error) {
+	payload := url.Values{
+		"client_id":  []string{config.ClientId},
+		"scope":      []string{joinScopes(config.Scopes)},
+		"login_hint": []string{config.LoginHint},
+	}
+
+	// Add optional client secret
+	if config.ClientSecret != "" {
+		payload.Set("client_secret", config.ClientSecret)
+	}
+
+	if config.BindingMessage != "" {
+		payload.Set("binding_message", config.BindingMessage)
+	}
+
+	if clientNotificationToken != "" {
+		payload.Set("client_notification_token", clientNotificationToken)
+	}
+
+	// Add optional audience
+	if config.Audience != "" {
+		payload.Set("audience", config.Audience)
+	}
+
+	// Add optional resource indicators
+	for _, resource := range config.Resources {
+		payload.Add("resource", resource)
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.BackchannelAuthenticationEndpoint, bytes.NewBufferString(payload.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create HTTP request", ErrInternal)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Execute the HTTP request
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHTTPFailure, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+
+		var errorResponse tokenErrorResponse
+		_ = json.Unmarshal(body, &errorResponse)
+		switch errorResponse.Error {
+		case "access_denied":
+			return nil, ErrUserDenied
+		case "invalid_scope":
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, errorResponse.ErrorDescription)
+		case "unknown_user_id", "invalid_client", "unauthorized_client":
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidConfig, errorResponse.Error, errorResponse.ErrorDescription)
+		default:
+			return nil, fmt.Errorf("%w: unexpected HTTP status %d: %s", ErrInvalidResponse, resp.StatusCode, string(body))
+		}
+	}
+
+	// Parse the response body
+	var authResponse BackchannelAuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResponse); err != nil {
+		return nil, errors.Join(fmt.Errorf("%w: failed to decode response body", ErrInvalidResponse), err)
+	}
+
+	if authResponse.AuthReqID == "" || authResponse.ExpiresIn <= 0 {
+		return nil, fmt.Errorf("%w: missing auth_req_id or expires_in", ErrMissingResponseData)
+	}
+
+	return &authResponse, nil
+}
+
+// PollForBackchannelToken requests the token of a CIBA request from the token endpoint until the
+// user approved the request or the timeout expired. The token endpoint is polled every interval,
+// or after a notification on ping if it is not nil, falling back to the interval if a
+// notification is lost.
+func PollForBackchannelToken(ctx context.Context, config Config, authReqID string, timeout time.Duration, interval time.Duration, ping <-chan struct{}) (*AccessTokenResponse, error) {
+	payload := url.Values{
+		"auth_req_id": []string{authReqID},
+		"grant_type":  []string{CIBA.String()},
+	}
+
+	return pollToken(ctx, config, payload, timeout, interval, ping)
+}
+
+// FetchCIBAToken runs the CIBA grant: it asks the provider to obtain the approval of the user of
+// the login hint on their device, passes the binding message to notify and waits for the token,
+// either by polling or, in ping mode, for the notification of the provider.
+func FetchCIBAToken(ctx context.Context, config Config, notify func(bindingMessage string)) (*AccessTokenResponse, error) {
+	var (
+		clientNotificationToken string
+		ping                    <-chan struct{}
+	)
+
+	if config.backchannelTokenDeliveryMode() == BackchannelTokenDeliveryPing {
+		listener, _, err := listenLoopback(config.BackchannelClientNotificationEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		defer listener.Close()
+
+		if clientNotificationToken, err = randomString(32); err != nil {
+			return nil, err
+		}
+
+		notifications := make(chan struct{}, 1)
+		server := &http.Server{
+			ReadHeaderTimeout: 10 * time.Second,
+			Handler:           backchannelNotificationHandler(listener.callbackPath, clientNotificationToken, notifications),
+		}
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		defer server.Close()
+
+		ping = notifications
+	}
+
+	authResponse, err := RequestBackchannelAuthentication(ctx, config, clientNotificationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	notify(config.BindingMessage)
+
+	interval := time.Duration(authResponse.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultBackchannelInterval
+	}
+
+	return PollForBackchannelToken(ctx, config, authResponse.AuthReqID, time.Duration(authResponse.ExpiresIn)*time.Second, interval, ping)
+}
+
+// backchannelNotificationHandler accepts the ping notifications of the provider that carry the
+// client notification token and signals them on notifications.
+func backchannelNotificationHandler(callbackPath, clientNotificationToken string, notifications chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != callbackPath {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		expected := "Bearer " + clientNotificationToken
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		select {
+		case notifications <- struct{}{}:
+		default:
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigIsValidCIBA(t *testing.T) {
+	valid := func() Config {
+		return Config{
+			ClientId:                          "client_id",
+			TokenEndpoint:                     "https://example.com/token",
+			BackchannelAuthenticationEndpoint: "https://example.com/bc-authorize",
+			LoginHint:                         "alice@example.com",
+			Scopes:                            []string{"openid"},
+			GrantType:                         CIBA,
+			StorageProvider:                   storage.NewMemoryStorage("test"),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{name: "poll mode", modify: func(c *Config) {}},
+		{name: "ping mode", modify: func(c *Config) { WithBackchannelPing("http://127.0.0.1:4711/ciba")(c) }},
+		{name: "missing endpoint", modify: func(c *Config) { c.BackchannelAuthenticationEndpoint = "" }, wantErr: true},
+		{name: "missing login hint", modify: func(c *Config) { c.LoginHint = "" }, wantErr: true},
+		{name: "missing openid scope", modify: func(c *Config) { c.Scopes = []string{"profile"} }, wantErr: true},
+		{name: "ping mode without endpoint", modify: func(c *Config) { c.BackchannelTokenDeliveryMode = BackchannelTokenDeliveryPing }, wantErr: true},
+		{name: "push mode", modify: func(c *Config) { c.BackchannelTokenDeliveryMode = "push" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid()
+			tt.modify(&config)
+
+			err := config.IsValid()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidConfig)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLoginWithCIBA(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/bc-authorize":
+			assert.Equal(t, "alice@example.com", r.PostForm.Get("login_hint"))
+			assert.Equal(t, "approve deploy 42", r.PostForm.Get("binding_message"))
+			assert.Equal(t, "openid", r.PostForm.Get("scope"))
+			assert.Empty(t, r.PostForm.Get("client_notification_token"))
+			_, _ = w.Write([]byte(`{"auth_req_id": "request_id", "expires_in": 10, "interval": 1}`))
+		case "/token":
+			assert.Equal(t, CIBA.String(), r.PostForm.Get("grant_type"))
+			assert.Equal(t, "request_id", r.PostForm.Get("auth_req_id"))
+			if polls.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error": "authorization_pending"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token": "ciba_token", "token_type": "Bearer", "expires_in": 3600, "id_token": "id_token"}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := storage.NewMemoryStorage("test")
+	cmd := NewLoginCommand(
+		WithClientID("client_id"),
+		WithGrantType(CIBA),
+		WithTokenEndpoint(server.URL+"/token"),
+		WithBackchannelAuthenticationEndpoint(server.URL+"/bc-authorize"),
+		WithLoginHint("alice@example.com"),
+		WithBindingMessage("approve deploy 42"),
+		WithScopes([]string{"openid"}),
+		WithStorageProvider(provider),
+	)
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(nil)
+	require.NoError(t, cmd.Execute())
+
+	assert.Contains(t, out.String(), "approve deploy 42")
+	assert.Equal(t, int32(2), polls.Load())
+
+	tokenSet, err := LoadTokenSet(provider)
+	require.NoError(t, err)
+	assert.Equal(t, "ciba_token", tokenSet.AccessToken)
+	assert.Equal(t, "id_token", tokenSet.IDToken)
+}
+
+func TestFetchCIBATokenDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bc-authorize" {
+			_, _ = w.Write([]byte(`{"auth_req_id": "request_id", "expires_in": 10}`))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error": "access_denied"}`))
+	}))
+	defer server.Close()
+
+	config := Config{
+		ClientId:                          "client_id",
+		TokenEndpoint:                     server.URL + "/token",
+		BackchannelAuthenticationEndpoint: server.URL + "/bc-authorize",
+		LoginHint:                         "alice@example.com",
+		Scopes:                            []string{"openid"},
+		GrantType:                         CIBA,
+	}
+
+	_, err := FetchCIBAToken(context.Background(), config, func(string) {})
+	assert.ErrorIs(t, err, ErrUserDenied)
+}
+
+func TestFetchCIBATokenPing(t *testing.T) {
+	// The client notification endpoint is registered with the provider, so it needs a fixed port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	notificationEndpoint := fmt.Sprintf("http://%s/ciba", listener.Addr())
+	require.NoError(t, listener.Close())
+
+	var (
+		notified atomic.Bool
+		polls    atomic.Int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/bc-authorize":
+			token := r.PostForm.Get("client_notification_token")
+			assert.NotEmpty(t, token)
+
+			// Notify the client once the user approved the request on their device
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				for _, bearer := range []string{"wrong_token", token} {
+					body, _ := json.Marshal(map[string]string{"auth_req_id": "request_id"})
+					req, _ := http.NewRequest(http.MethodPost, notificationEndpoint, bytes.NewReader(body))
+					req.Header.Set("Authorization", "Bearer "+bearer)
+					req.Header.Set("Content-Type", "application/json")
+					resp, err := http.DefaultClient.Do(req)
+					if !assert.NoError(t, err) {
+						return
+					}
+					resp.Body.Close()
+					if bearer == token {
+						assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+					} else {
+						assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+						notified.Store(true)
+					}
+				}
+			}()
+
+			_, _ = w.Write([]byte(`{"auth_req_id": "request_id", "expires_in": 10, "interval": 1}`))
+		case "/token":
+			polls.Add(1)
+			assert.True(t, notified.Load(), "token requested before the notification")
+			_, _ = w.Write([]byte(`{"access_token": "ciba_token", "token_type": "Bearer", "expires_in": 3600}`))
+		}
+	}))
+	defer server.Close()
+
+	config := Config{
+		ClientId:                          "client_id",
+		TokenEndpoint:                     server.URL + "/token",
+		BackchannelAuthenticationEndpoint: server.URL + "/bc-authorize",
+		LoginHint:                         "alice@example.com",
+		Scopes:                            []string{"openid"},
+		GrantType:                         CIBA,
+	}
+	WithBackchannelPing(notificationEndpoint)(&config)
+
+	response, err := FetchCIBAToken(context.Background(), config, func(string) {})
+	require.NoError(t, err)
+	assert.Equal(t, "ciba_token", response.AccessToken)
+	assert.Equal(t, int32(1), polls.Load())
+}
@@ -24,6 +24,11 @@ func FetchClientCredentialsToken(ctx context.Context, config Config) (*AccessTok
 		payload.Set("audience", config.Audience)
 	}
 
+	// Add optional resource indicators
+	for _, resource := range config.Resources {
+		payload.Add("resource", resource)
+	}
+
 	// Execute the HTTP request
 	client := &http.Client{Timeout: 15 * time.Second}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenEndpoint, bytes.NewBufferString(payload.Encode()))
@@ -1,125 +1,292 @@
 package auth
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"time"
 
-	"github.com/golang-jwt/jwt"
 	"github.com/nauthera/cobra-oauth2/pkg/storage"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func NewLoginCommand(options ...Option) *cobra.Command {
-	return &cobra.Command{
-		Use:   "login",
-		Short: "Authenticate with your OAuth2 provider using the device flow.",
+	var email string
+
+	cmd := &cobra.Command{
+		Use:         "login",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Authenticate with your OAuth2 provider using the device flow.",
 		Long: `The "login" command initiates the OAuth2 Device Flow, allowing you to authenticate
 with an OAuth2 provider. This flow is ideal for command-line tools that cannot display
 a web browser for authentication. The user will be prompted to visit a URL and enter a
 code to authenticate the CLI tool.
-`,
-		Run: func(cmd *cobra.Command, args []string) {
-			authConfig, err := configure(options...)
-			if err != nil {
-				cmd.PrintErr("error configuring auth: ", err)
-				return
-			}
 
-			var accessToken *AccessTokenResponse
+If the CLI is configured for the authorization code grant, the browser is opened on the
+authorization endpoint instead and the result is received on a loopback redirect URI.
 
-			switch authConfig.GrantType {
-			case DeviceCode:
-				deviceCode, err := FetchDeviceCode(cmd.Context(), *authConfig)
-				if err != nil {
-					cmd.PrintErr("error fetching device code: ", err)
-					return
+With --email, the issuer of your organization is discovered from your email address with
+OpenID Connect WebFinger discovery and stored in the profile of the configuration file.
+The CLI must be configured with a configuration file.
+`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var issuer string
+			loginOptions := options
+			if email != "" {
+				if newConfig(options).ConfigFile == "" {
+					return commandError("failed to discover issuer", fmt.Errorf("%w: --email requires a configuration file to store the issuer in", ErrInvalidConfig))
 				}
 
-				Handle(*cmd, deviceCode.VerificationURIComplete)
-
-				accessToken, err = PollForAccessToken(
-					cmd.Context(),
-					*authConfig,
-					deviceCode.DeviceCode,
-					time.Duration(deviceCode.ExpiresIn)*time.Second,
-					time.Duration(deviceCode.Interval)*time.Second,
-				)
-				if err != nil {
-					cmd.PrintErr("error polling for access token: ", err)
-					return
-				}
-			case ClientCredentials:
-				accessToken, err = FetchClientCredentialsToken(cmd.Context(), *authConfig)
-				if err != nil {
-					cmd.PrintErr("error fetching access token: ", err)
-					return
+				var err error
+				if issuer, err = DiscoverIssuer(cmd.Context(), email); err != nil {
+					return commandError("failed to discover issuer", err)
 				}
-			default:
-				cmd.PrintErr("unsupported grant type: ", authConfig.GrantType)
-				return
+				loginOptions = append(slices.Clip(options), overrideIssuer(issuer))
+			}
+
+			authConfig, err := configureContext(cmd.Context(), loginOptions...)
+			if err != nil {
+				return commandError("failed to configure auth", err)
+			}
+
+			accessToken, err := login(cmd, *authConfig)
+			if err != nil {
+				return commandError("login failed", err)
+			}
+
+			if _, err := SaveLoginTokenSet(*authConfig, *accessToken); err != nil {
+				return commandError("failed to store access token", err)
 			}
 
 			validFor := time.Duration(accessToken.ExpiresIn) * time.Second
 			cmd.Println("Successfully authenticated!")
 			cmd.Println("Your access token is valid for", validFor, "seconds.")
 
-			storageProvider := storage.NewKeyringStorage(authConfig.ClientId)
-			if err := storageProvider.SetToken(jwt.Token{
-				Raw: accessToken.AccessToken,
-			}); err != nil {
-				cmd.PrintErr("error storing access token: ", err)
-				return
+			if issuer != "" {
+				saved, err := saveProfileIssuer(*authConfig, issuer)
+				if err != nil {
+					return commandError("failed to store issuer", err)
+				}
+				if saved {
+					cmd.Println("Stored issuer", issuer, "in the configuration file.")
+				}
 			}
+
+			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&email, "email", "", "discover the issuer from your email address with WebFinger")
+
+	return cmd
 }
 
 func NewTokenCommand(options ...Option) *cobra.Command {
-	return &cobra.Command{
-		Use:   "token",
-		Short: "A brief description of your command",
-		Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			authConfig, err := configure(options...)
+	var (
+		resource string
+		output   string
+		minValid time.Duration
+		decode   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:         "token",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Print the current access token.",
+		Long: `The "token" command prints the stored access token. The token is refreshed first if it
+expires within --min-valid. The command fails if no token valid for at least that long is
+available, so scripts can rely on its exit code.
+
+Output formats:
+  raw     the access token (default)
+  json    the access token with its type, expiry and scope
+  header  an Authorization header
+  env     a shell export statement, e.g. eval "$(mycli token -o env)"
+  curl    a curl config file, e.g. curl -K <(mycli token -o curl) https://api.example.com
+
+With --decode, the header and claims of a JWT access token are printed instead. The token
+signature is not verified.
+`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, err := configureContext(cmd.Context(), options...)
 			if err != nil {
-				cmd.PrintErr("error configuring auth: ", err)
-				return
+				return commandError("failed to configure auth", err)
 			}
 
-			storageProvider := storage.NewKeyringStorage(authConfig.ClientId)
-			token, err := storageProvider.GetToken()
+			tokenSet, err := fetchToken(cmd.Context(), *authConfig, tokenRequest{resource: resource, minValid: minValid})
 			if err != nil {
-				cmd.PrintErr("error fetching token: ", err)
-				os.Exit(1)
+				return commandError("failed to fetch token", err)
+			}
+
+			if !tokenSet.Valid() || tokenSet.ExpiresWithin(minValid) {
+				return commandError("failed to fetch token", fmt.Errorf("%w: no token valid for at least %s", ErrAccessTokenExpired, minValid))
 			}
 
-			cmd.Print(token)
-		}}
+			if decode {
+				err = writeDecodedToken(cmd.OutOrStdout(), tokenSet.AccessToken)
+			} else {
+				err = writeToken(cmd.OutOrStdout(), *tokenSet, output)
+			}
+			if err != nil {
+				return commandError("failed to print token", err)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&resource, "resource", "", "return a token restricted to the given resource indicator (RFC 8707)")
+	cmd.Flags().StringVarP(&output, "output", "o", TokenOutputRaw, "output format: raw, json, header, env or curl")
+	cmd.Flags().DurationVar(&minValid, "min-valid", DefaultExpiryDelta, "refresh the token if it expires within this duration")
+	cmd.Flags().BoolVar(&decode, "decode", false, "print the decoded header and claims of a JWT access token without verifying it")
+
+	return cmd
 }
 
 func NewLogoutCommand(options ...Option) *cobra.Command {
-	return &cobra.Command{
-		Use: "logout",
-		Run: func(cmd *cobra.Command, args []string) {
-			authConfig, err := configure(options...)
+	var federated bool
+
+	cmd := &cobra.Command{
+		Use:         "logout",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Remove the stored tokens.",
+		Long: `The "logout" command removes the stored tokens.
+
+With --federated, you are also logged out of the session at your OAuth2 provider, so that the
+next login does not sign you in again silently. The browser is opened on the end session
+endpoint of the provider, and the tokens are removed once the provider confirms the logout.
+`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, err := configureContext(cmd.Context(), options...)
 			if err != nil {
-				cmd.PrintErr("error configuring auth: ", err)
-				return
+				return commandError("failed to configure auth", err)
+			}
+
+			if federated {
+				if err := authConfig.discover(cmd.Context()); err != nil {
+					return commandError("failed to log out of the provider", err)
+				}
+
+				var idToken string
+				if tokenSet, err := LoadTokenSet(authConfig.StorageProvider); err == nil {
+					idToken = tokenSet.IDToken
+				}
+
+				err := EndSession(cmd.Context(), *authConfig, idToken, func(endSessionURL string) {
+					HandleLogoutURL(*cmd, endSessionURL)
+				})
+				if err != nil {
+					return commandError("failed to log out of the provider", err)
+				}
 			}
 
-			storageProvider := storage.NewKeyringStorage(authConfig.ClientId)
-			err = storageProvider.DeleteToken()
+			err = deleteTokenSets(*authConfig)
 			if err != nil {
-				cmd.PrintErr("error logging out: ", err)
-				os.Exit(1)
+				return commandError("failed to log out", err)
 			}
 
 			cmd.Println("Successfully logged out.")
+
+			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&federated, "federated", false, "also log out of the session at the OAuth2 provider")
+
+	return cmd
+}
+
+// login obtains a new login token with the configured grant, interacting with the user through
+// the output of cmd.
+func login(cmd *cobra.Command, authConfig Config) (*AccessTokenResponse, error) {
+	if err := authConfig.prepareFlow(cmd.Context(), cmd.ErrOrStderr()); err != nil {
+		return nil, err
+	}
+
+	switch authConfig.GrantType {
+	case DeviceCode:
+		deviceCode, err := FetchDeviceCode(cmd.Context(), authConfig)
+		if err != nil {
+			return nil, fmt.Errorf("fetching device code: %w", err)
+		}
+
+		Handle(*cmd, deviceCode.VerificationURIComplete)
+
+		accessToken, err := PollForAccessToken(
+			cmd.Context(),
+			authConfig,
+			deviceCode.DeviceCode,
+			time.Duration(deviceCode.ExpiresIn)*time.Second,
+			time.Duration(deviceCode.Interval)*time.Second,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("polling for access token: %w", err)
+		}
+		return accessToken, nil
+	case AuthorizationCode:
+		accessToken, err := FetchAuthorizationCodeToken(cmd.Context(), authConfig, func(authorizationURL string) {
+			HandleAuthorizationURL(*cmd, authorizationURL)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("fetching access token: %w", err)
+		}
+		return accessToken, nil
+	case CIBA:
+		accessToken, err := FetchCIBAToken(cmd.Context(), authConfig, func(bindingMessage string) {
+			HandleBackchannelAuthentication(*cmd, authConfig.LoginHint, bindingMessage)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("waiting for approval: %w", err)
+		}
+		return accessToken, nil
+	case ClientCredentials:
+		accessToken, err := FetchClientCredentialsToken(cmd.Context(), authConfig)
+		if err != nil {
+			return nil, fmt.Errorf("fetching access token: %w", err)
+		}
+		return accessToken, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported grant type: %s", ErrInvalidConfig, authConfig.GrantType)
+	}
+}
+
+// ensureToken returns the token set for the resource, refreshed if it expires within
+// DefaultExpiryDelta. If the user has to log in and the session is interactive, or the grant
+// needs no user, the login flow is run first.
+func ensureToken(cmd *cobra.Command, authConfig Config, resource string, interactive bool) (*TokenSet, error) {
+	request := tokenRequest{resource: resource, minValid: DefaultExpiryDelta}
+	tokenSet, err := fetchToken(cmd.Context(), authConfig, request)
+	if err == nil || (!interactive && authConfig.GrantType.needsUser()) || !loginRequired(err) {
+		return tokenSet, err
+	}
+
+	accessToken, err := login(cmd, authConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := SaveLoginTokenSet(authConfig, *accessToken); err != nil {
+		return nil, fmt.Errorf("storing access token: %w", err)
+	}
+
+	return fetchToken(cmd.Context(), authConfig, request)
+}
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// loginRequired reports whether err means that no usable token is stored and the user has to
+// log in again.
+func loginRequired(err error) bool {
+	return errors.Is(err, storage.ErrTokenNotFound) || errors.Is(err, ErrInvalidTokenResponse)
 }
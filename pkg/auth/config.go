@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/url"
+	"slices"
 	"strings"
 
 	"github.com/go-playground/validator"
@@ -13,25 +16,137 @@ type Option func(*Config)
 
 // Config defines the configuration for OAuth2 device flow.
 type Config struct {
-	ClientId                    string   `json:"client_id" validate:"required"`
-	ClientSecret                string   `json:"client_secret,omitempty"`
-	DeviceAuthorizationEndpoint string   `json:"auth_url" validate:"required,url"`
-	TokenEndpoint               string   `json:"token_url" validate:"required,url"`
-	Scopes                      []string `json:"scopes" validate:"required,min=1,dive,required"`
-	Audience                    string   `json:"audience,omitempty"`
-	StorageProvider             storage.StorageProvider
-	GrantType                   GrantType `json:"grant_type"`
+	ClientId                           string                  `json:"client_id" validate:"required"`
+	ClientSecret                       string                  `json:"client_secret,omitempty"`
+	Issuer                             string                  `json:"issuer,omitempty" validate:"omitempty,url"`
+	AuthorizationEndpoint              string                  `json:"authorization_url,omitempty" validate:"omitempty,url"`
+	DeviceAuthorizationEndpoint        string                  `json:"auth_url" validate:"omitempty,url"`
+	PushedAuthorizationRequestEndpoint string                  `json:"par_url,omitempty" validate:"omitempty,url"`
+	TokenEndpoint                      string                  `json:"token_url" validate:"required,url"`
+	RedirectURI                        string                  `json:"redirect_uri,omitempty" validate:"omitempty,url"`
+	Scopes                             []string                `json:"scopes" validate:"required,min=1,dive,required"`
+	Audience                           string                  `json:"audience,omitempty"`
+	Resources                          []string                `json:"resources,omitempty" validate:"omitempty,dive,url"`
+	StorageProvider                    storage.StorageProvider `json:"-"`
+	GrantType                          GrantType               `json:"grant_type"`
+	// UsePushedAuthorizationRequests sends the authorization request parameters to the
+	// pushed authorization request endpoint (RFC 9126) instead of the browser URL.
+	UsePushedAuthorizationRequests bool `json:"use_par,omitempty"`
+	// Registries are the container registries that the Docker credential helper serves the
+	// access token to, see NewDockerCredentialHelperCommand.
+	Registries []string `json:"registries,omitempty"`
+	// RegistryUsername is the username that the Docker credential helper returns with the
+	// access token. It defaults to DefaultRegistryUsername.
+	RegistryUsername string `json:"registry_username,omitempty"`
+	// GitHosts are the hosts that the Git credential helper serves the access token to, see
+	// NewGitCredentialCommand.
+	GitHosts []string `json:"git_hosts,omitempty"`
+	// GitUsername is the username that the Git credential helper returns with the access
+	// token. It defaults to DefaultGitUsername.
+	GitUsername string `json:"git_username,omitempty"`
+	// AllowedURLs are the base URLs that the request command sends the access token to, see
+	// NewRequestCommand.
+	AllowedURLs []string `json:"allowed_urls,omitempty" validate:"omitempty,dive,url"`
+	// UseAgent reads and writes tokens through the token agent if one is running,
+	// see NewAgentCommand.
+	UseAgent bool `json:"use_agent,omitempty"`
+	// AgentSocket is the socket of the token agent. It defaults to
+	// storage.DefaultAgentSocketPath for the client ID.
+	AgentSocket string `json:"agent_socket,omitempty"`
+	// EndSessionEndpoint is the OpenID Connect end session endpoint used by the logout command
+	// with --federated.
+	EndSessionEndpoint string `json:"end_session_url,omitempty" validate:"omitempty,url"`
+	// PostLogoutRedirectURI is the loopback URI that the provider redirects to after the end
+	// session request. It defaults to DefaultPostLogoutRedirectURI.
+	PostLogoutRedirectURI string `json:"post_logout_redirect_uri,omitempty" validate:"omitempty,url"`
+	// BackchannelAuthenticationEndpoint is the endpoint of the CIBA grant.
+	BackchannelAuthenticationEndpoint string `json:"backchannel_authentication_url,omitempty" validate:"omitempty,url"`
+	// BackchannelTokenDeliveryMode is the token delivery mode of the CIBA grant,
+	// BackchannelTokenDeliveryPoll (default) or BackchannelTokenDeliveryPing.
+	BackchannelTokenDeliveryMode string `json:"backchannel_token_delivery_mode,omitempty"`
+	// BackchannelClientNotificationEndpoint is the loopback URI that receives the notifications
+	// of the CIBA ping mode. It must match the client notification endpoint registered with
+	// the provider, including the port.
+	BackchannelClientNotificationEndpoint string `json:"backchannel_client_notification_url,omitempty" validate:"omitempty,url"`
+	// LoginHint identifies the user that is asked for approval by the CIBA grant.
+	LoginHint string `json:"login_hint,omitempty"`
+	// BindingMessage is shown both by the CLI and on the device of the user by the CIBA grant,
+	// so that the user can verify that the request originates from the CLI.
+	BindingMessage string `json:"binding_message,omitempty"`
+	// RegistrationEndpoint is the dynamic client registration endpoint (RFC 7591) used by
+	// NewRegisterCommand.
+	RegistrationEndpoint string `json:"registration_url,omitempty" validate:"omitempty,url"`
+	// RegistrationAccessToken authorizes the management of the registered client (RFC 7592).
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	// RegistrationClientURI is the client configuration endpoint of the registered client.
+	RegistrationClientURI string `json:"registration_client_uri,omitempty" validate:"omitempty,url"`
+	// ConfigFile is the path of the configuration file with named profiles, see WithConfigFile.
+	ConfigFile string `json:"-"`
+	// Profile is the profile of the configuration file to use. It defaults to the current
+	// profile of the file, or DefaultProfile.
+	Profile string `json:"-"`
+
+	// WarningHandler receives warnings about the configuration, e.g. scopes that the provider
+	// does not advertise, when a flow starts. It defaults to printing the warnings to the error
+	// output of the command.
+	WarningHandler func(warning string) `json:"-"`
+
+	// metadata is the authorization server metadata that the endpoints were discovered from
+	metadata *AuthorizationServerMetadataResponse
+	// storageBackend is the storage backend selected by the profile of the configuration file
+	storageBackend string
+	// storageProfile is the profile of the configuration file that the tokens are stored for
+	storageProfile string
+	// overrides are applied after all options, e.g. the values of flags bound with BindFlags
+	overrides []Option
 }
 
 func (c Config) IsValid() error {
 	if c.StorageProvider == nil {
-		return fmt.Errorf("storage provider is required")
+		return fmt.Errorf("%w: storage provider is required", ErrInvalidConfig)
 	}
 
 	validate := validator.New()
 	if err := validate.Struct(c); err != nil {
 		return err
 	}
+
+	switch c.GrantType {
+	case DeviceCode:
+		if c.DeviceAuthorizationEndpoint == "" {
+			return fmt.Errorf("%w: device authorization endpoint is required for the %s grant", ErrInvalidConfig, c.GrantType)
+		}
+	case AuthorizationCode:
+		if c.AuthorizationEndpoint == "" {
+			return fmt.Errorf("%w: authorization endpoint is required for the %s grant", ErrInvalidConfig, c.GrantType)
+		}
+		if c.UsePushedAuthorizationRequests && c.PushedAuthorizationRequestEndpoint == "" {
+			return fmt.Errorf("%w: pushed authorization request endpoint is required", ErrInvalidConfig)
+		}
+	case CIBA:
+		if c.BackchannelAuthenticationEndpoint == "" {
+			return fmt.Errorf("%w: backchannel authentication endpoint is required for the %s grant", ErrInvalidConfig, c.GrantType)
+		}
+		if c.LoginHint == "" {
+			return fmt.Errorf("%w: login hint is required for the %s grant", ErrInvalidConfig, c.GrantType)
+		}
+		if !slices.Contains(c.Scopes, "openid") {
+			return fmt.Errorf("%w: the openid scope is required for the %s grant", ErrInvalidConfig, c.GrantType)
+		}
+		switch c.BackchannelTokenDeliveryMode {
+		case "", BackchannelTokenDeliveryPoll:
+		case BackchannelTokenDeliveryPing:
+			if c.BackchannelClientNotificationEndpoint == "" {
+				return fmt.Errorf("%w: client notification endpoint is required for the ping mode", ErrInvalidConfig)
+			}
+		default:
+			return fmt.Errorf("%w: unsupported token delivery mode %s", ErrInvalidConfig, c.BackchannelTokenDeliveryMode)
+		}
+	case ClientCredentials, "":
+	default:
+		return fmt.Errorf("%w: unsupported grant type %s", ErrInvalidConfig, c.GrantType)
+	}
+
 	return nil
 }
 
@@ -47,6 +162,12 @@ func WithClientSecret(clientSecret string) Option {
 	}
 }
 
+func WithAuthorizationEndpoint(authorizationEndpoint string) Option {
+	return func(c *Config) {
+		c.AuthorizationEndpoint = authorizationEndpoint
+	}
+}
+
 func WithDeviceAuthorizationEndpoint(deviceAuthorizationEndpoint string) Option {
 	return func(c *Config) {
 		c.DeviceAuthorizationEndpoint = deviceAuthorizationEndpoint
@@ -59,6 +180,53 @@ func WithTokenEndpoint(tokenEndpoint string) Option {
 	}
 }
 
+func WithPushedAuthorizationRequestEndpoint(pushedAuthorizationRequestEndpoint string) Option {
+	return func(c *Config) {
+		c.PushedAuthorizationRequestEndpoint = pushedAuthorizationRequestEndpoint
+	}
+}
+
+// WithRegistrationEndpoint sets the dynamic client registration endpoint (RFC 7591). It is
+// discovered from the metadata of the issuer if not set.
+func WithRegistrationEndpoint(registrationEndpoint string) Option {
+	return func(c *Config) {
+		c.RegistrationEndpoint = registrationEndpoint
+	}
+}
+
+// WithEndSessionEndpoint sets the OpenID Connect end session endpoint. It is discovered from the
+// metadata of the issuer if not set.
+func WithEndSessionEndpoint(endSessionEndpoint string) Option {
+	return func(c *Config) {
+		c.EndSessionEndpoint = endSessionEndpoint
+	}
+}
+
+// WithPostLogoutRedirectURI sets the loopback URI that the provider redirects to after logging
+// out of the provider session. If the URI has no port, a random free port is chosen.
+func WithPostLogoutRedirectURI(postLogoutRedirectURI string) Option {
+	return func(c *Config) {
+		c.PostLogoutRedirectURI = postLogoutRedirectURI
+	}
+}
+
+// WithPushedAuthorizationRequests enables pushed authorization requests (RFC 9126) for the
+// authorization code grant. It is enabled automatically if the discovery document sets
+// require_pushed_authorization_requests.
+func WithPushedAuthorizationRequests() Option {
+	return func(c *Config) {
+		c.UsePushedAuthorizationRequests = true
+	}
+}
+
+// WithRedirectURI sets the loopback redirect URI used by the authorization code grant.
+// If the URI has no port, a random free port is chosen when the flow starts.
+func WithRedirectURI(redirectURI string) Option {
+	return func(c *Config) {
+		c.RedirectURI = redirectURI
+	}
+}
+
 func WithScopes(scopes []string) Option {
 	return func(c *Config) {
 		c.Scopes = scopes
@@ -71,6 +239,24 @@ func WithAudience(audience string) Option {
 	}
 }
 
+// WithResources sets the resource indicators (RFC 8707) sent with every authorization and token request.
+func WithResources(resources []string) Option {
+	return func(c *Config) {
+		c.Resources = resources
+	}
+}
+
+// WithIssuer sets the issuer URL of the OAuth2 provider, e.g. "https://idp.example.com/tenant".
+// The endpoints that are not configured explicitly are discovered from the OpenID Connect
+// discovery document or the authorization server metadata (RFC 8414) of the issuer. The issuer
+// in the metadata must match exactly, which protects against mix-up attacks. The metadata is only
+// fetched if required endpoints are missing or when a flow starts.
+func WithIssuer(issuer string) Option {
+	return func(c *Config) {
+		c.Issuer = issuer
+	}
+}
+
 func WithDiscoveryURL(discoveryURL url.URL) Option {
 	metadata, err := FetchConfigFromDiscoveryURL(discoveryURL)
 	if err != nil {
@@ -85,11 +271,111 @@ func WithDiscoveryURL(discoveryURL url.URL) Option {
 	}
 
 	return func(c *Config) {
+		c.metadata = metadata
+		c.AuthorizationEndpoint = metadata.AuthorizationEndpoint
 		c.DeviceAuthorizationEndpoint = deviceAuthorizationEndpoint
+		c.PushedAuthorizationRequestEndpoint = metadata.PushedAuthorizationRequestEndpoint
 		c.TokenEndpoint = metadata.TokenEndpoint
+		c.RegistrationEndpoint = metadata.RegistrationEndpoint
+		c.EndSessionEndpoint = metadata.EndSessionEndpoint
+		c.BackchannelAuthenticationEndpoint = metadata.BackchannelAuthenticationEndpoint
+		if metadata.RequirePushedAuthorizationRequests {
+			c.UsePushedAuthorizationRequests = true
+		}
+	}
+}
+
+// setIssuer sets the issuer and discards the configured endpoints, so that they are discovered
+// from the issuer.
+func (c *Config) setIssuer(issuer string) {
+	c.Issuer = issuer
+	c.AuthorizationEndpoint = ""
+	c.DeviceAuthorizationEndpoint = ""
+	c.PushedAuthorizationRequestEndpoint = ""
+	c.TokenEndpoint = ""
+	c.RegistrationEndpoint = ""
+	c.EndSessionEndpoint = ""
+	c.BackchannelAuthenticationEndpoint = ""
+}
+
+// applyMetadata sets the endpoints of the configuration that are not set yet from the
+// authorization server metadata.
+func (c *Config) applyMetadata(metadata AuthorizationServerMetadataResponse) {
+	setDefault := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+
+	setDefault(&c.AuthorizationEndpoint, metadata.AuthorizationEndpoint)
+	setDefault(&c.DeviceAuthorizationEndpoint, metadata.DeviceAuthorizationEndpoint)
+	// if device authorization endpoint is empty fallback to authorization url
+	setDefault(&c.DeviceAuthorizationEndpoint, metadata.AuthorizationEndpoint)
+	setDefault(&c.PushedAuthorizationRequestEndpoint, metadata.PushedAuthorizationRequestEndpoint)
+	setDefault(&c.TokenEndpoint, metadata.TokenEndpoint)
+	setDefault(&c.RegistrationEndpoint, metadata.RegistrationEndpoint)
+	setDefault(&c.EndSessionEndpoint, metadata.EndSessionEndpoint)
+	setDefault(&c.BackchannelAuthenticationEndpoint, metadata.BackchannelAuthenticationEndpoint)
+	if metadata.RequirePushedAuthorizationRequests {
+		c.UsePushedAuthorizationRequests = true
 	}
 }
 
+// discover fetches the metadata of the issuer and sets the endpoints that are not configured
+// explicitly. The metadata is only fetched once.
+func (c *Config) discover(ctx context.Context) error {
+	if c.Issuer == "" || c.metadata != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultDiscoveryTimeout)
+	defer cancel()
+
+	metadata, err := FetchIssuerMetadata(ctx, c.Issuer)
+	if err != nil {
+		return fmt.Errorf("failed to fetch OAuth2 metadata of issuer %s: %w", c.Issuer, err)
+	}
+
+	c.applyMetadata(*metadata)
+	c.metadata = metadata
+	return nil
+}
+
+// needsDiscovery reports whether endpoints that are required to use the stored tokens or to log
+// in with the grant are missing, so that they have to be discovered from the issuer. Otherwise
+// the issuer is only contacted when a flow starts, see prepareFlow.
+func (c Config) needsDiscovery() bool {
+	if c.Issuer == "" || c.metadata != nil {
+		return false
+	}
+
+	if c.TokenEndpoint == "" {
+		return true
+	}
+
+	switch c.GrantType {
+	case DeviceCode:
+		return c.DeviceAuthorizationEndpoint == ""
+	case AuthorizationCode:
+		return c.AuthorizationEndpoint == "" || (c.UsePushedAuthorizationRequests && c.PushedAuthorizationRequestEndpoint == "")
+	case CIBA:
+		return c.BackchannelAuthenticationEndpoint == ""
+	default:
+		return false
+	}
+}
+
+// prepareFlow discovers the metadata of the issuer before a flow is started, if it was not
+// discovered yet, and checks the configuration against the capabilities of the provider.
+// Warnings are written to warnings unless a warning handler is configured.
+func (c *Config) prepareFlow(ctx context.Context, warnings io.Writer) error {
+	if err := c.discover(ctx); err != nil {
+		return err
+	}
+
+	return c.checkCapabilities(warnings)
+}
+
 func WithStorageProvider(storageProvider storage.StorageProvider) Option {
 	return func(c *Config) {
 		c.StorageProvider = storageProvider
@@ -102,7 +388,161 @@ func WithGrantType(grantType GrantType) Option {
 	}
 }
 
+// WithRegistries sets the container registries that the Docker credential helper serves the
+// access token to.
+func WithRegistries(registries []string) Option {
+	return func(c *Config) {
+		c.Registries = registries
+	}
+}
+
+// WithRegistryUsername sets the username that the Docker credential helper returns with the
+// access token.
+func WithRegistryUsername(username string) Option {
+	return func(c *Config) {
+		c.RegistryUsername = username
+	}
+}
+
+// WithGitHosts sets the hosts that the Git credential helper serves the access token to.
+func WithGitHosts(hosts []string) Option {
+	return func(c *Config) {
+		c.GitHosts = hosts
+	}
+}
+
+// WithGitUsername sets the username that the Git credential helper returns with the access token.
+func WithGitUsername(username string) Option {
+	return func(c *Config) {
+		c.GitUsername = username
+	}
+}
+
+// WithAllowedURLs sets the base URLs that the request command sends the access token to.
+// A URL matches if it has the same scheme and host and its path starts with the path of a
+// base URL.
+func WithAllowedURLs(urls []string) Option {
+	return func(c *Config) {
+		c.AllowedURLs = urls
+	}
+}
+
+// WithWarningHandler sets the function that receives warnings about the configuration instead
+// of printing them to the error output of the command.
+func WithWarningHandler(handler func(warning string)) Option {
+	return func(c *Config) {
+		c.WarningHandler = handler
+	}
+}
+
+// WithAgent uses the token agent started by NewAgentCommand for token storage when it is running.
+func WithAgent() Option {
+	return func(c *Config) {
+		c.UseAgent = true
+	}
+}
+
+// WithAgentSocket uses the token agent listening on the given socket for token storage when it
+// is running.
+func WithAgentSocket(path string) Option {
+	return func(c *Config) {
+		c.UseAgent = true
+		c.AgentSocket = path
+	}
+}
+
+// agentSocketPath returns the socket of the token agent for the configuration.
+func (c Config) agentSocketPath() string {
+	if c.AgentSocket != "" {
+		return c.AgentSocket
+	}
+	return storage.DefaultAgentSocketPath(c.ClientId)
+}
+
 func configure(options ...Option) (*Config, error) {
+	return configureContext(context.Background(), options...)
+}
+
+// configureContext builds the configuration like configure and uses ctx to discover the
+// endpoints of the issuer, if they are needed.
+func configureContext(ctx context.Context, options ...Option) (*Config, error) {
+	authConfig, err := configureBacking(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if authConfig.UseAgent && storage.AgentAvailable(authConfig.agentSocketPath()) {
+		authConfig.StorageProvider = storage.NewAgentStorage(authConfig.agentSocketPath())
+	}
+
+	if err := authConfig.applyProfileStorage(); err != nil {
+		return nil, err
+	}
+
+	return authConfig, nil
+}
+
+// configureBacking builds the configuration with the configured storage provider, without
+// switching to a running token agent.
+func configureBacking(ctx context.Context, options ...Option) (*Config, error) {
+	return configureWithFile(ctx, options, nil)
+}
+
+// configureWithFile builds the configuration with the given configuration file instead of the
+// one configured with WithConfigFile, if file is not nil.
+func configureWithFile(ctx context.Context, options []Option, file *ConfigFile) (*Config, error) {
+	authConfig, err := resolveConfig(ctx, options, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authConfig.IsValid(); err != nil {
+		return nil, err
+	}
+
+	return authConfig, nil
+}
+
+// resolveConfig builds the configuration from the options, the configuration file and, if
+// required endpoints are missing, the metadata of the issuer, without validating it.
+func resolveConfig(ctx context.Context, options []Option, file *ConfigFile) (*Config, error) {
+	authConfig := newConfig(options)
+
+	if file == nil && authConfig.ConfigFile != "" {
+		var err error
+		if file, err = LoadConfigFile(authConfig.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if file != nil {
+		if err := file.apply(authConfig); err != nil {
+			return nil, err
+		}
+
+		// Flags and environment variables take precedence over the configuration file
+		authConfig.applyOverrides()
+	}
+
+	if err := authConfig.applyStorageBackend(); err != nil {
+		return nil, err
+	}
+
+	if err := authConfig.loadRegistrationSecrets(); err != nil {
+		return nil, err
+	}
+
+	if authConfig.needsDiscovery() {
+		if err := authConfig.discover(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return authConfig, nil
+}
+
+// newConfig applies the options and overrides to the default configuration.
+func newConfig(options []Option) *Config {
 	authConfig := &Config{
 		Scopes:    strings.Split(DefaultScopes, " "),
 		GrantType: DefaultGrantType,
@@ -112,9 +552,13 @@ func configure(options ...Option) (*Config, error) {
 		opt(authConfig)
 	}
 
-	if err := authConfig.IsValid(); err != nil {
-		return nil, err
-	}
+	authConfig.applyOverrides()
 
-	return authConfig, nil
+	return authConfig
+}
+
+func (c *Config) applyOverrides() {
+	for _, override := range c.overrides {
+		override(c)
+	}
 }
@@ -0,0 +1,460 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultProfile is the profile that is used if no profile is selected and the
+	// configuration file has no current profile.
+	DefaultProfile = "default"
+
+	// StorageKeyring stores tokens in the keyring of the operating system.
+	StorageKeyring = "keyring"
+	// StorageMemory keeps tokens in memory for the lifetime of the process.
+	StorageMemory = "memory"
+
+	// profileStorageKey is the key of the storage backend in a profile
+	profileStorageKey = "storage"
+	// profileStorageKeyPrefix is the prefix of the storage key of the tokens of a profile
+	profileStorageKeyPrefix = "profile:"
+)
+
+// ConfigFile is a configuration file with named profiles. A profile holds configuration
+// values under their JSON names, e.g. "issuer", "client_id", "scopes" or "grant_type", and
+// the storage backend under "storage". Files with the extension ".json" are read and written
+// as JSON, all others as YAML:
+//
+//	current_profile: staging
+//	profiles:
+//	  default:
+//	    issuer: https://auth.example.com
+//	    client_id: mycli
+//	  staging:
+//	    issuer: https://auth.staging.example.com
+//	    client_id: mycli-staging
+//	    scopes: [openid, offline_access]
+//	    grant_type: authorization_code
+//	    storage: keyring
+type ConfigFile struct {
+	CurrentProfile string                    `json:"current_profile,omitempty" yaml:"current_profile,omitempty"`
+	Profiles       map[string]map[string]any `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+}
+
+// DefaultConfigPath returns the path of the configuration file of the application in the
+// user's configuration directory, e.g. $XDG_CONFIG_HOME/<app>/config.yaml on Linux.
+func DefaultConfigPath(app string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, app, "config.yaml"), nil
+}
+
+// WithConfigFile reads the configuration from the profile of the configuration file at path,
+// see ConfigFile. Values of the profile take precedence over the other options, and flags and
+// environment variables bound with BindFlags take precedence over the profile. A missing file
+// is ignored, so that the configuration in code is used until a file is created.
+func WithConfigFile(path string) Option {
+	return func(c *Config) {
+		c.ConfigFile = path
+	}
+}
+
+// WithProfile selects the profile of the configuration file.
+func WithProfile(profile string) Option {
+	return func(c *Config) {
+		c.Profile = profile
+	}
+}
+
+// LoadConfigFile reads the configuration file at path. A missing file is returned as an empty
+// configuration file.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ConfigFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	var file ConfigFile
+	if isJSONFile(path) {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse configuration file %s: %v", ErrInvalidConfig, path, err)
+	}
+
+	return &file, nil
+}
+
+// Save writes the configuration file to path. The file is only readable by the current user,
+// since profiles may hold a client secret.
+func (f ConfigFile) Save(path string) error {
+	data, err := f.encode(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create configuration directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write configuration file: %w", err)
+	}
+
+	return nil
+}
+
+func (f ConfigFile) encode(path string) ([]byte, error) {
+	if isJSONFile(path) {
+		data, err := json.MarshalIndent(f, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Get returns the value of key in the profile.
+func (f ConfigFile) Get(profile, key string) (any, bool) {
+	value, ok := f.Profiles[f.profileName(profile)][key]
+	return value, ok
+}
+
+// Set sets the value of key in the profile, creating the profile if needed. Lists are
+// separated by commas or spaces, and an empty value removes the key from the profile.
+func (f *ConfigFile) Set(profile, key, value string) error {
+	kind, ok := profileKeys()[key]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %s, valid keys are %s", ErrInvalidConfig, key, strings.Join(slices.Sorted(maps.Keys(profileKeys())), ", "))
+	}
+
+	name := f.profileName(profile)
+	if value == "" {
+		delete(f.Profiles[name], key)
+		return nil
+	}
+
+	var parsed any
+	switch kind {
+	case reflect.Slice:
+		parsed = splitList(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%w: %s must be true or false", ErrInvalidConfig, key)
+		}
+		parsed = b
+	default:
+		parsed = value
+	}
+
+	if f.Profiles == nil {
+		f.Profiles = map[string]map[string]any{}
+	}
+	if f.Profiles[name] == nil {
+		f.Profiles[name] = map[string]any{}
+	}
+	f.Profiles[name][key] = parsed
+
+	return nil
+}
+
+// profileName returns the name of the selected profile.
+func (f ConfigFile) profileName(profile string) string {
+	switch {
+	case profile != "":
+		return profile
+	case f.CurrentProfile != "":
+		return f.CurrentProfile
+	default:
+		return DefaultProfile
+	}
+}
+
+// apply sets the values of the selected profile in the configuration. Selecting a profile that
+// does not exist is an error, unless it is the default profile.
+func (f ConfigFile) apply(c *Config) error {
+	name := f.profileName(c.Profile)
+	values, ok := f.Profiles[name]
+	if !ok {
+		if c.Profile != "" {
+			return fmt.Errorf("%w: profile %s not found in configuration file", ErrInvalidConfig, name)
+		}
+		return nil
+	}
+
+	c.storageProfile = name
+	values = maps.Clone(values)
+	if backend, ok := values[profileStorageKey]; ok {
+		c.storageBackend = fmt.Sprint(backend)
+		delete(values, profileStorageKey)
+	}
+	if grantType, ok := values["grant_type"]; ok {
+		parsed, err := ParseGrantType(fmt.Sprint(grantType))
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		values["grant_type"] = parsed
+	}
+
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("%w: profile %s: %v", ErrInvalidConfig, name, err)
+	}
+
+	var profile Config
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profile); err != nil {
+		return fmt.Errorf("%w: profile %s: %v", ErrInvalidConfig, name, err)
+	}
+
+	// Like the issuer flag, an issuer in the profile replaces the endpoints configured in code
+	if profile.Issuer != "" && profile.TokenEndpoint == "" {
+		c.setIssuer(profile.Issuer)
+	}
+
+	return json.Unmarshal(raw, c)
+}
+
+// applyStorageBackend replaces the storage provider with the storage backend selected by the
+// configuration file.
+func (c *Config) applyStorageBackend() error {
+	switch c.storageBackend {
+	case "":
+	case StorageKeyring:
+		c.StorageProvider = storage.NewKeyringStorage(c.ClientId)
+	case StorageMemory:
+		c.StorageProvider = storage.NewMemoryStorage(c.ClientId)
+	default:
+		return fmt.Errorf("%w: unsupported storage backend %s, use %s or %s", ErrInvalidConfig, c.storageBackend, StorageKeyring, StorageMemory)
+	}
+	return nil
+}
+
+// applyProfileStorage stores the tokens of a profile of the configuration file under a key of
+// the profile, so that a profile never uses the tokens of another issuer or client. The tokens
+// of the configuration in code keep the keys of the storage provider.
+func (c *Config) applyProfileStorage() error {
+	if c.storageProfile == "" {
+		return nil
+	}
+
+	keyed, ok := c.StorageProvider.(storage.KeyedStorageProvider)
+	if !ok {
+		return fmt.Errorf("%w: the storage provider cannot separate the tokens of profile %s", ErrInvalidConfig, c.storageProfile)
+	}
+
+	c.StorageProvider = storage.NewPrefixedStorage(keyed, c.tokenStorageKey())
+	return nil
+}
+
+// tokenStorageKey returns the storage key of the login token set, which is the key of the profile
+// of the configuration file, see applyProfileStorage.
+func (c Config) tokenStorageKey() string {
+	if c.storageProfile == "" {
+		return ""
+	}
+	return profileStorageKeyPrefix + c.storageProfile
+}
+
+// profileKeys returns the keys of a profile and the kinds of their values.
+func profileKeys() map[string]reflect.Kind {
+	keys := map[string]reflect.Kind{profileStorageKey: reflect.String}
+
+	t := reflect.TypeOf(Config{})
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		keys[name] = field.Type.Kind()
+	}
+
+	return keys
+}
+
+func isJSONFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// splitList splits a list separated by commas or spaces.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// NewConfigCommand creates a command to view and edit the configuration file set with
+// WithConfigFile. The profile is selected with WithProfile or the --profile flag of BindFlags.
+func NewConfigCommand(options ...Option) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "config",
+		Annotations: skipAuthAnnotations(),
+		Short:       "View and edit the configuration file.",
+		Long: `The "config" command views and edits the configuration file. The file holds named
+profiles with the issuer, client ID, scopes, grant type and storage backend, so that a team
+can share a checked-in configuration. Values of the selected profile take precedence over the
+defaults of the CLI, and flags and environment variables take precedence over the profile.
+`,
+	}
+
+	var noValidate bool
+	set := &cobra.Command{
+		Use:   "set KEY VALUE",
+		Short: "Set a value of the profile.",
+		Long: `The "set" command sets a value of the selected profile. Lists are separated by commas
+or spaces, and an empty value removes the key. The resulting configuration is validated
+before the file is written, which may contact the issuer to discover its endpoints.
+`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, file, err := loadConfigFile(options)
+			if err != nil {
+				return commandError("failed to load configuration file", err)
+			}
+
+			if err := file.Set(authConfig.Profile, args[0], args[1]); err != nil {
+				return commandError("failed to set "+args[0], err)
+			}
+
+			if !noValidate {
+				validated, err := configureWithFile(cmd.Context(), options, file)
+				if err == nil {
+					err = validated.prepareFlow(cmd.Context(), cmd.ErrOrStderr())
+				}
+				if err != nil {
+					return commandError("invalid configuration", err)
+				}
+			}
+
+			if err := file.Save(authConfig.ConfigFile); err != nil {
+				return commandError("failed to save configuration file", err)
+			}
+
+			return nil
+		},
+	}
+	set.Flags().BoolVar(&noValidate, "no-validate", false, "write the value without validating the configuration")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:          "view",
+			Short:        "Print the configuration file.",
+			Args:         cobra.NoArgs,
+			SilenceUsage: true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				authConfig, file, err := loadConfigFile(options)
+				if err != nil {
+					return commandError("failed to load configuration file", err)
+				}
+
+				data, err := file.encode(authConfig.ConfigFile)
+				if err != nil {
+					return commandError("failed to print configuration file", err)
+				}
+
+				_, err = cmd.OutOrStdout().Write(data)
+				return err
+			},
+		},
+		&cobra.Command{
+			Use:          "get KEY",
+			Short:        "Print a value of the profile.",
+			Args:         cobra.ExactArgs(1),
+			SilenceUsage: true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				authConfig, file, err := loadConfigFile(options)
+				if err != nil {
+					return commandError("failed to load configuration file", err)
+				}
+
+				value, ok := file.Get(authConfig.Profile, args[0])
+				if !ok {
+					return commandError("failed to get "+args[0], fmt.Errorf("%w: %s is not set in profile %s", ErrInvalidConfig, args[0], file.profileName(authConfig.Profile)))
+				}
+
+				return writeProfileValue(cmd.OutOrStdout(), value)
+			},
+		},
+		set,
+	)
+
+	return cmd
+}
+
+// loadConfigFile reads the configuration file configured by the options.
+func loadConfigFile(options []Option) (*Config, *ConfigFile, error) {
+	authConfig := newConfig(options)
+	if authConfig.ConfigFile == "" {
+		return nil, nil, fmt.Errorf("%w: no configuration file configured", ErrInvalidConfig)
+	}
+
+	file, err := LoadConfigFile(authConfig.ConfigFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authConfig, file, nil
+}
+
+// writeProfileValue writes a value of a profile, with list items separated by commas.
+func writeProfileValue(w io.Writer, value any) error {
+	switch value.(type) {
+	case []string, []any:
+		value = strings.Join(profileList(value), ",")
+	}
+
+	_, err := fmt.Fprintln(w, value)
+	return err
+}
+
+// profileList returns the items of a list value of a profile, which is a []any when read from
+// the file and a []string when set with ConfigFile.Set.
+func profileList(value any) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []any:
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return items
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigFile = `current_profile: staging
+profiles:
+  default:
+    client_id: default_client
+    token_url: https://default.example.com/token
+    auth_url: https://default.example.com/device
+  staging:
+    client_id: staging_client
+    token_url: https://staging.example.com/token
+    authorization_url: https://staging.example.com/authorize
+    scopes: [openid, offline_access]
+    grant_type: authorization_code
+    storage: memory
+`
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfigureWithConfigFile(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", testConfigFile)
+	codeOptions := []Option{
+		WithClientID("code_client"),
+		WithDeviceAuthorizationEndpoint("https://code.example.com/device"),
+		WithTokenEndpoint("https://code.example.com/token"),
+		WithStorageProvider(storage.NewKeyringStorage("test")),
+		WithConfigFile(path),
+	}
+
+	t.Run("current profile", func(t *testing.T) {
+		config, err := configure(codeOptions...)
+		require.NoError(t, err)
+		assert.Equal(t, "staging_client", config.ClientId)
+		assert.Equal(t, "https://staging.example.com/token", config.TokenEndpoint)
+		assert.Equal(t, []string{"openid", "offline_access"}, config.Scopes)
+		assert.Equal(t, AuthorizationCode, config.GrantType)
+		// Values that are not set by the profile are kept
+		assert.Equal(t, "https://code.example.com/device", config.DeviceAuthorizationEndpoint)
+
+		backing, err := configureBacking(context.Background(), codeOptions...)
+		require.NoError(t, err)
+		assert.IsType(t, storage.NewMemoryStorage(""), backing.StorageProvider)
+	})
+
+	t.Run("selected profile", func(t *testing.T) {
+		config, err := configure(append(codeOptions, WithProfile("default"))...)
+		require.NoError(t, err)
+		assert.Equal(t, "default_client", config.ClientId)
+		assert.Equal(t, DeviceCode, config.GrantType)
+		assert.Equal(t, "https://default.example.com/device", config.DeviceAuthorizationEndpoint)
+	})
+
+	t.Run("flags take precedence", func(t *testing.T) {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		bind := BindFlags(flags, "")
+		require.NoError(t, flags.Parse([]string{"--profile", "default", "--client-id", "flag_client"}))
+
+		config, err := configure(append([]Option{bind}, codeOptions...)...)
+		require.NoError(t, err)
+		assert.Equal(t, "flag_client", config.ClientId)
+		assert.Equal(t, "https://default.example.com/token", config.TokenEndpoint)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		_, err := configure(append(codeOptions, WithProfile("production"))...)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		config, err := configure(append(codeOptions, WithConfigFile(filepath.Join(t.TempDir(), "config.yaml")))...)
+		require.NoError(t, err)
+		assert.Equal(t, "code_client", config.ClientId)
+	})
+}
+
+func TestProfilesDoNotShareTokens(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `profiles:
+  staging:
+    token_url: https://staging.example.com/token
+  prod:
+    token_url: https://prod.example.com/token
+`)
+	provider := storage.NewMemoryStorage("test")
+	codeOptions := []Option{
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(provider),
+	}
+	profileOptions := func(profile string) []Option {
+		return append(slices.Clip(codeOptions), WithConfigFile(path), WithProfile(profile))
+	}
+
+	staging, err := configure(profileOptions("staging")...)
+	require.NoError(t, err)
+	_, err = SaveLoginTokenSet(*staging, AccessTokenResponse{AccessToken: "staging_token"})
+	require.NoError(t, err)
+	resourceStorage, _ := storageForKey(staging.StorageProvider, resourceKey("https://api.example.com"))
+	require.NoError(t, SaveTokenSet(resourceStorage, TokenSet{AccessToken: "staging_resource_token"}))
+
+	prod, err := configure(profileOptions("prod")...)
+	require.NoError(t, err)
+	_, err = LoadTokenSet(prod.StorageProvider)
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+	prodResourceStorage, _ := storageForKey(prod.StorageProvider, resourceKey("https://api.example.com"))
+	_, err = LoadTokenSet(prodResourceStorage)
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	// The configuration in code does not see the tokens of a profile either
+	code, err := configure(codeOptions...)
+	require.NoError(t, err)
+	_, err = LoadTokenSet(code.StorageProvider)
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	staging, err = configure(profileOptions("staging")...)
+	require.NoError(t, err)
+	tokenSet, err := LoadTokenSet(staging.StorageProvider)
+	require.NoError(t, err)
+	assert.Equal(t, "staging_token", tokenSet.AccessToken)
+}
+
+func TestConfigFileValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "unknown key", content: "profiles:\n  default:\n    client: test\n"},
+		{name: "invalid grant type", content: "profiles:\n  default:\n    grant_type: password\n"},
+		{name: "invalid storage", content: "profiles:\n  default:\n    storage: file\n"},
+		{name: "invalid token endpoint", content: "profiles:\n  default:\n    token_url: not a url\n"},
+		{name: "invalid syntax", content: "profiles: [\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := configure(
+				WithClientID("test"),
+				WithDeviceAuthorizationEndpoint("https://example.com/device"),
+				WithTokenEndpoint("https://example.com/token"),
+				WithStorageProvider(storage.NewMemoryStorage("test")),
+				WithConfigFile(writeConfigFile(t, "config.yaml", tt.content)),
+			)
+			assert.Error(t, err)
+			assert.Equal(t, ExitCodeConfig, ExitCode(err))
+		})
+	}
+}
+
+func TestConfigFileJSON(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"profiles": {"default": {"client_id": "json_client", "scopes": ["openid"]}}}`)
+
+	config, err := configure(
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(storage.NewMemoryStorage("test")),
+		WithConfigFile(path),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "json_client", config.ClientId)
+	assert.Equal(t, []string{"openid"}, config.Scopes)
+
+	file, err := LoadConfigFile(path)
+	require.NoError(t, err)
+	require.NoError(t, file.Set("", "grant_type", "client_credentials"))
+	require.NoError(t, file.Save(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"grant_type": "client_credentials"`)
+}
+
+func TestConfigCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mycli", "config.yaml")
+	options := []Option{
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(storage.NewMemoryStorage("test")),
+		WithConfigFile(path),
+		WithProfile("team"),
+	}
+
+	run := func(args ...string) (string, error) {
+		cmd := NewConfigCommand(options...)
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	_, err := run("set", "client_id", "team_client")
+	require.NoError(t, err)
+	_, err = run("set", "scopes", "openid,profile email")
+	require.NoError(t, err)
+
+	out, err := run("get", "scopes")
+	require.NoError(t, err)
+	assert.Equal(t, "openid,profile,email\n", out)
+
+	out, err = run("view")
+	require.NoError(t, err)
+	assert.Contains(t, out, "team:")
+	assert.Contains(t, out, "client_id: team_client")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	t.Run("invalid value is not saved", func(t *testing.T) {
+		_, err := run("set", "token_url", "not a url")
+		assert.Equal(t, ExitCodeConfig, ExitCode(err))
+
+		_, err = run("get", "token_url")
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := run("set", "client", "test")
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	})
+
+	t.Run("remove value", func(t *testing.T) {
+		_, err := run("set", "scopes", "")
+		require.NoError(t, err)
+
+		_, err = run("get", "scopes")
+		assert.Error(t, err)
+	})
+}
@@ -51,6 +51,30 @@ func TestConfig_IsValid(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "authorization code without authorization endpoint",
+			config: Config{
+				ClientId:        "client_id",
+				TokenEndpoint:   "https://example.com/token",
+				Scopes:          []string{"scope1"},
+				StorageProvider: storage.NewMemoryStorage("test"),
+				GrantType:       AuthorizationCode,
+			},
+			wantErr: true,
+		},
+		{
+			name: "pushed authorization requests without endpoint",
+			config: Config{
+				ClientId:                       "client_id",
+				AuthorizationEndpoint:          "https://example.com/authorize",
+				TokenEndpoint:                  "https://example.com/token",
+				Scopes:                         []string{"scope1"},
+				StorageProvider:                storage.NewMemoryStorage("test"),
+				GrantType:                      AuthorizationCode,
+				UsePushedAuthorizationRequests: true,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -6,5 +6,28 @@ const (
 	DefaultScopes  string        = "openid profile email"
 	DefaultTimeout time.Duration = 2 * time.Minute
 
+	// DefaultDiscoveryTimeout is the timeout for fetching the metadata of the issuer.
+	DefaultDiscoveryTimeout time.Duration = 10 * time.Second
+
+	// DefaultExpiryDelta is the remaining lifetime below which access tokens are refreshed
+	// proactively before they are sent to a resource server.
+	DefaultExpiryDelta time.Duration = time.Minute
+
+	// DefaultRedirectURI is the loopback redirect URI used by the authorization code grant.
+	// The port is chosen at random when the flow starts.
+	DefaultRedirectURI string = "http://127.0.0.1/callback"
+
+	// DefaultPostLogoutRedirectURI is the loopback URI that the provider redirects to after the
+	// logout. The port is chosen at random when the logout starts.
+	DefaultPostLogoutRedirectURI string = "http://127.0.0.1/logout"
+
 	DefaultGrantType GrantType = DeviceCode
+
+	// DefaultRegistryUsername is the username returned with the access token by the Docker
+	// credential helper. Registries that accept OAuth2 access tokens ignore it.
+	DefaultRegistryUsername string = "oauth2accesstoken"
+
+	// DefaultGitUsername is the username returned with the access token by the Git credential
+	// helper.
+	DefaultGitUsername string = "oauth2"
 )
@@ -47,6 +47,11 @@ func FetchDeviceCode(ctx context.Context, config Config) (*DeviceAuthResponse, e
 		formData.Set(key, value)
 	}
 
+	// Add optional resource indicators
+	for _, resource := range config.Resources {
+		formData.Add("resource", resource)
+	}
+
 	// Create HTTP request
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.DeviceAuthorizationEndpoint, bytes.NewBufferString(formData.Encode()))
 	if err != nil {
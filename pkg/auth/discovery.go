@@ -1,9 +1,13 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 type AuthorizationServerMetadataResponse struct {
@@ -20,6 +24,13 @@ type AuthorizationServerMetadataResponse struct {
 	ServiceDocumentation                       string   `json:"service_documentation"`
 	UILocalesSupported                         []string `json:"ui_locales_supported"`
 	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint"`
+	PushedAuthorizationRequestEndpoint         string   `json:"pushed_authorization_request_endpoint"`
+	RequirePushedAuthorizationRequests         bool     `json:"require_pushed_authorization_requests"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+	EndSessionEndpoint                         string   `json:"end_session_endpoint"`
+	BackchannelAuthenticationEndpoint          string   `json:"backchannel_authentication_endpoint"`
+	BackchannelTokenDeliveryModesSupported     []string `json:"backchannel_token_delivery_modes_supported"`
 }
 
 // FetchConfigFromDiscoveryURL retrieves the authorization server metadata from the given discovery URL.
@@ -32,10 +43,76 @@ type AuthorizationServerMetadataResponse struct {
 //   - A pointer to an AuthorizationServerMetadataResponse struct containing the metadata.
 //   - An error if the HTTP request fails or the response cannot be decoded.
 func FetchConfigFromDiscoveryURL(discoveryURL url.URL) (*AuthorizationServerMetadataResponse, error) {
-	response, err := http.Get(discoveryURL.String())
+	return fetchMetadata(context.Background(), discoveryURL.String())
+}
+
+// FetchIssuerMetadata retrieves the metadata of the issuer from the OpenID Connect discovery
+// document or, if that is not available, from the OAuth 2.0 authorization server metadata
+// (RFC 8414). The issuer in the metadata must be identical to the given issuer, otherwise
+// ErrIssuerMismatch is returned to prevent mix-up attacks.
+func FetchIssuerMetadata(ctx context.Context, issuer string) (*AuthorizationServerMetadataResponse, error) {
+	discoveryURLs, err := issuerDiscoveryURLs(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, discoveryURL := range discoveryURLs {
+		metadata, err := fetchMetadata(ctx, discoveryURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", discoveryURL, err))
+			continue
+		}
+
+		if metadata.Issuer != issuer {
+			return nil, fmt.Errorf("%w: %s returned issuer %q instead of %q", ErrIssuerMismatch, discoveryURL, metadata.Issuer, issuer)
+		}
+
+		return metadata, nil
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// issuerDiscoveryURLs returns the locations of the metadata of the issuer. The OpenID Connect
+// discovery document is located by appending the well-known path to the issuer, while RFC 8414
+// inserts it between the host and the path of the issuer:
+//
+//	https://idp.example.com/tenant/.well-known/openid-configuration
+//	https://idp.example.com/.well-known/oauth-authorization-server/tenant
+func issuerDiscoveryURLs(issuer string) ([]string, error) {
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid issuer: %v", ErrInvalidConfig, err)
+	}
+
+	if issuerURL.Scheme == "" || issuerURL.Host == "" || issuerURL.RawQuery != "" || issuerURL.Fragment != "" {
+		return nil, fmt.Errorf("%w: issuer %s must be an absolute URL without query and fragment", ErrInvalidConfig, issuer)
+	}
+
+	base := issuerURL.Scheme + "://" + issuerURL.Host
+	path := strings.TrimSuffix(issuerURL.EscapedPath(), "/")
+
+	return []string{
+		base + path + "/.well-known/openid-configuration",
+		base + "/.well-known/oauth-authorization-server" + path,
+	}, nil
+}
+
+// fetchMetadata retrieves the authorization server metadata from the given URL.
+func fetchMetadata(ctx context.Context, discoveryURL string) (*AuthorizationServerMetadataResponse, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: DefaultDiscoveryTimeout}
+	response, err := client.Do(request)
 	if err != nil {
 		return nil, err
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode >= 400 {
 		return nil, ErrInvalidResponse
@@ -1,10 +1,18 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFetchConfigFromDiscoveryURL(t *testing.T) {
@@ -70,3 +78,176 @@ func TestFetchConfigFromDiscoveryURL(t *testing.T) {
 		})
 	}
 }
+
+func TestIssuerDiscoveryURLs(t *testing.T) {
+	tests := []struct {
+		issuer  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			issuer: "https://idp.example.com",
+			want: []string{
+				"https://idp.example.com/.well-known/openid-configuration",
+				"https://idp.example.com/.well-known/oauth-authorization-server",
+			},
+		},
+		{
+			issuer: "https://idp.example.com/",
+			want: []string{
+				"https://idp.example.com/.well-known/openid-configuration",
+				"https://idp.example.com/.well-known/oauth-authorization-server",
+			},
+		},
+		{
+			issuer: "https://idp.example.com:8443/realms/tenant 1",
+			want: []string{
+				"https://idp.example.com:8443/realms/tenant%201/.well-known/openid-configuration",
+				"https://idp.example.com:8443/.well-known/oauth-authorization-server/realms/tenant%201",
+			},
+		},
+		{issuer: "https://idp.example.com/tenant?x=1", wantErr: true},
+		{issuer: "https://idp.example.com/tenant#x", wantErr: true},
+		{issuer: "idp.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.issuer, func(t *testing.T) {
+			urls, err := issuerDiscoveryURLs(tt.issuer)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidConfig)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, urls)
+		})
+	}
+}
+
+func TestFetchIssuerMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		// paths maps the paths served by the provider to the issuer in their metadata
+		paths   map[string]string
+		issuer  string
+		wantErr error
+	}{
+		{
+			name:   "OpenID Connect discovery",
+			paths:  map[string]string{"/tenant/.well-known/openid-configuration": "/tenant"},
+			issuer: "/tenant",
+		},
+		{
+			name:   "authorization server metadata",
+			paths:  map[string]string{"/.well-known/oauth-authorization-server/tenant": "/tenant"},
+			issuer: "/tenant",
+		},
+		{
+			name:    "issuer mismatch",
+			paths:   map[string]string{"/tenant/.well-known/openid-configuration": "/other"},
+			issuer:  "/tenant",
+			wantErr: ErrIssuerMismatch,
+		},
+		{
+			name:    "trailing slash mismatch",
+			paths:   map[string]string{"/.well-known/openid-configuration": "/"},
+			issuer:  "",
+			wantErr: ErrIssuerMismatch,
+		},
+		{
+			name:    "not found",
+			paths:   map[string]string{},
+			issuer:  "/tenant",
+			wantErr: ErrInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				issuer, ok := tt.paths[r.URL.Path]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				assert.NoError(t, json.NewEncoder(w).Encode(AuthorizationServerMetadataResponse{
+					Issuer:        server.URL + issuer,
+					TokenEndpoint: server.URL + "/token",
+				}))
+			}))
+			defer server.Close()
+
+			metadata, err := FetchIssuerMetadata(context.Background(), server.URL+tt.issuer)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, server.URL+tt.issuer, metadata.Issuer)
+			assert.Equal(t, server.URL+"/token", metadata.TokenEndpoint)
+		})
+	}
+}
+
+func TestWithIssuer(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(AuthorizationServerMetadataResponse{
+			Issuer:                      server.URL,
+			TokenEndpoint:               server.URL + "/token",
+			DeviceAuthorizationEndpoint: server.URL + "/device",
+		}))
+	}))
+	defer server.Close()
+
+	options := []Option{
+		WithClientID("client_id"),
+		WithStorageProvider(storage.NewMemoryStorage("test")),
+	}
+
+	config, err := configure(append(options, WithIssuer(server.URL), WithTokenEndpoint("https://example.com/token"))...)
+	require.NoError(t, err)
+	// Endpoints configured explicitly take precedence over the metadata
+	assert.Equal(t, "https://example.com/token", config.TokenEndpoint)
+	assert.Equal(t, server.URL+"/device", config.DeviceAuthorizationEndpoint)
+
+	_, err = configure(append(options, WithIssuer(server.URL+"/"))...)
+	assert.ErrorIs(t, err, ErrIssuerMismatch)
+	assert.Equal(t, ExitCodeConfig, ExitCode(err))
+}
+
+func TestDiscoveryIsLazy(t *testing.T) {
+	var requests atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.NoError(t, json.NewEncoder(w).Encode(AuthorizationServerMetadataResponse{
+			Issuer:               server.URL,
+			TokenEndpoint:        server.URL + "/token",
+			RegistrationEndpoint: server.URL + "/register",
+		}))
+	}))
+	defer server.Close()
+
+	options := []Option{
+		WithIssuer(server.URL),
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(storage.NewMemoryStorage("test")),
+	}
+
+	// The stored tokens can be used without contacting the issuer
+	config, err := configure(options...)
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), requests.Load())
+	assert.Empty(t, config.RegistrationEndpoint)
+
+	// Starting a flow discovers the metadata once
+	require.NoError(t, config.prepareFlow(context.Background(), io.Discard))
+	require.NoError(t, config.prepareFlow(context.Background(), io.Discard))
+	assert.Equal(t, int32(1), requests.Load())
+	assert.Equal(t, "https://example.com/token", config.TokenEndpoint)
+	assert.Equal(t, server.URL+"/register", config.RegistrationEndpoint)
+}
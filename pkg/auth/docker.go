@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// errDockerCredentialsNotFound is the error message that the Docker CLI recognizes as missing
+// credentials of a credential helper.
+var errDockerCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// dockerCredentials are the credentials exchanged with the Docker CLI.
+type dockerCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// NewDockerCredentialHelperCommand creates a command that implements the protocol of the
+// docker-credential-helpers. The Docker CLI receives the access token as password for the
+// registries configured with WithRegistries. Credentials are never stored by Docker; they are
+// issued by the OAuth2 provider after running the login command.
+func NewDockerCredentialHelperCommand(options ...Option) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "docker-credential",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Provide the access token to Docker as a credential helper.",
+		Long: `The "docker-credential" command implements the Docker credential helper protocol, so
+that Docker authenticates with the access token at the configured registries. Docker runs
+credential helpers as "docker-credential-<name>", so install a wrapper script in your PATH:
+
+  #!/bin/sh
+  exec mycli docker-credential "$@"
+
+and reference it in ~/.docker/config.json:
+
+  {"credHelpers": {"registry.example.com": "mycli"}}
+
+Log in with the login command before using Docker.
+`,
+	}
+
+	cmd.AddCommand(
+		newDockerCredentialCommand("get", "Print the credentials of a registry.", options, dockerGet),
+		newDockerCredentialCommand("store", "Accept credentials of a registry from docker login.", options, dockerStore),
+		newDockerCredentialCommand("erase", "Accept the removal of credentials by docker logout.", options, dockerErase),
+		newDockerCredentialCommand("list", "List the registries and their usernames.", options, dockerList),
+	)
+
+	return cmd
+}
+
+// newDockerCredentialCommand creates a subcommand of the credential helper. Errors are written
+// to stdout as required by the protocol, and returned for the exit code.
+func newDockerCredentialCommand(use, short string, options []Option, handle func(ctx context.Context, config Config, in io.Reader, out io.Writer) error) *cobra.Command {
+	return &cobra.Command{
+		Use:          use,
+		Short:        short,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, err := configureContext(cmd.Context(), options...)
+			if err == nil {
+				err = handle(cmd.Context(), *authConfig, cmd.InOrStdin(), cmd.OutOrStdout())
+			}
+			if err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+				return commandError("credential helper failed", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// dockerGet writes the access token for the registry read from in.
+func dockerGet(ctx context.Context, config Config, in io.Reader, out io.Writer) error {
+	serverURL, err := readServerURL(in)
+	if err != nil {
+		return err
+	}
+
+	if !isDockerRegistry(config, serverURL) {
+		return errDockerCredentialsNotFound
+	}
+
+	tokenSet, err := FetchResourceToken(ctx, config, "")
+	if err != nil {
+		if loginRequired(err) {
+			return fmt.Errorf("not logged in, run the login command first: %w", err)
+		}
+		return err
+	}
+
+	return json.NewEncoder(out).Encode(dockerCredentials{
+		ServerURL: serverURL,
+		Username:  registryUsername(config),
+		Secret:    tokenSet.AccessToken,
+	})
+}
+
+// dockerStore accepts the credentials of a configured registry. They are not stored, since the
+// access token is issued by the OAuth2 provider.
+func dockerStore(_ context.Context, config Config, in io.Reader, _ io.Writer) error {
+	var credentials dockerCredentials
+	if err := json.NewDecoder(in).Decode(&credentials); err != nil {
+		return fmt.Errorf("invalid credentials: %w", err)
+	}
+
+	if !isDockerRegistry(config, credentials.ServerURL) {
+		return fmt.Errorf("registry %s is not managed by this credential helper", credentials.ServerURL)
+	}
+
+	return nil
+}
+
+// dockerErase accepts the removal of the credentials of a configured registry. The login token
+// is kept, use the logout command to remove it.
+func dockerErase(_ context.Context, config Config, in io.Reader, _ io.Writer) error {
+	serverURL, err := readServerURL(in)
+	if err != nil {
+		return err
+	}
+
+	if !isDockerRegistry(config, serverURL) {
+		return errDockerCredentialsNotFound
+	}
+
+	return nil
+}
+
+// dockerList writes the configured registries with their usernames.
+func dockerList(_ context.Context, config Config, _ io.Reader, out io.Writer) error {
+	registries := map[string]string{}
+	for _, registry := range config.Registries {
+		registries[registry] = registryUsername(config)
+	}
+
+	return json.NewEncoder(out).Encode(registries)
+}
+
+// readServerURL reads the registry server URL sent by the Docker CLI.
+func readServerURL(in io.Reader) (string, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return "", err
+	}
+
+	serverURL := strings.TrimSpace(string(data))
+	if serverURL == "" {
+		return "", errors.New("no server URL")
+	}
+
+	return serverURL, nil
+}
+
+// isDockerRegistry reports whether serverURL refers to one of the configured registries.
+// Registries are compared by host, since the Docker CLI passes them with or without scheme.
+func isDockerRegistry(config Config, serverURL string) bool {
+	host := urlHost(serverURL)
+	for _, registry := range config.Registries {
+		if strings.EqualFold(urlHost(registry), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlHost returns the host and port of a URL that may lack a scheme.
+func urlHost(rawURL string) string {
+	host := rawURL
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	host, _, _ = strings.Cut(host, "/")
+	return host
+}
+
+func registryUsername(config Config) string {
+	if config.RegistryUsername != "" {
+		return config.RegistryUsername
+	}
+	return DefaultRegistryUsername
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// newDockerTestConfig returns the configuration of a logged in client with two registries.
+func newDockerTestConfig(t *testing.T) Config {
+	config := newTestConfig(t, "https://example.com/token", TokenSet{AccessToken: "access_token", Expiry: time.Now().Add(time.Hour)})
+	config.Registries = []string{"registry.example.com", "https://other.example.com:5000"}
+	return config
+}
+
+func TestDockerGet(t *testing.T) {
+	config := newDockerTestConfig(t)
+
+	tests := []struct {
+		name      string
+		serverURL string
+		wantErr   error
+	}{
+		{name: "host", serverURL: "registry.example.com"},
+		{name: "with scheme", serverURL: "https://registry.example.com/v2/\n"},
+		{name: "with port", serverURL: "other.example.com:5000"},
+		{name: "unknown registry", serverURL: "https://index.docker.io/v1/", wantErr: errDockerCredentialsNotFound},
+		{name: "different port", serverURL: "other.example.com", wantErr: errDockerCredentialsNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := dockerGet(context.Background(), config, strings.NewReader(tt.serverURL), &out)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+
+			var credentials dockerCredentials
+			assert.NoError(t, json.Unmarshal(out.Bytes(), &credentials))
+			assert.Equal(t, strings.TrimSpace(tt.serverURL), credentials.ServerURL)
+			assert.Equal(t, DefaultRegistryUsername, credentials.Username)
+			assert.Equal(t, "access_token", credentials.Secret)
+		})
+	}
+}
+
+func TestDockerGetNotLoggedIn(t *testing.T) {
+	config := newDockerTestConfig(t)
+	config.StorageProvider = storage.NewMemoryStorage("empty")
+
+	err := dockerGet(context.Background(), config, strings.NewReader("registry.example.com"), &bytes.Buffer{})
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+}
+
+func TestDockerStoreAndErase(t *testing.T) {
+	config := newDockerTestConfig(t)
+
+	err := dockerStore(context.Background(), config, strings.NewReader(`{"ServerURL":"registry.example.com","Username":"user","Secret":"secret"}`), nil)
+	assert.NoError(t, err)
+
+	err = dockerStore(context.Background(), config, strings.NewReader(`{"ServerURL":"unknown.example.com","Username":"user","Secret":"secret"}`), nil)
+	assert.Error(t, err)
+
+	assert.NoError(t, dockerErase(context.Background(), config, strings.NewReader("registry.example.com"), nil))
+	assert.ErrorIs(t, dockerErase(context.Background(), config, strings.NewReader("unknown.example.com"), nil), errDockerCredentialsNotFound)
+
+	// The login token is kept
+	_, err = LoadTokenSet(config.StorageProvider)
+	assert.NoError(t, err)
+}
+
+func TestDockerList(t *testing.T) {
+	config := newDockerTestConfig(t)
+	config.RegistryUsername = "user"
+
+	var out bytes.Buffer
+	assert.NoError(t, dockerList(context.Background(), config, nil, &out))
+	assert.JSONEq(t, `{"registry.example.com":"user","https://other.example.com:5000":"user"}`, out.String())
+}
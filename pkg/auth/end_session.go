@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// BuildEndSessionURL returns the URL of the end session endpoint that logs the user out of the
+// provider session (OpenID Connect RP-Initiated Logout). The ID token of the login is sent as
+// id_token_hint if it is not empty.
+func BuildEndSessionURL(config Config, idToken, postLogoutRedirectURI, state string) (string, error) {
+	endSessionURL, err := url.Parse(config.EndSessionEndpoint)
+	if err != nil || config.EndSessionEndpoint == "" {
+		return "", fmt.Errorf("%w: the provider has no end session endpoint", ErrInvalidConfig)
+	}
+
+	// Keep query parameters that are part of the configured endpoint
+	query := endSessionURL.Query()
+	query.Set("client_id", config.ClientId)
+	query.Set("post_logout_redirect_uri", postLogoutRedirectURI)
+	query.Set("state", state)
+	if idToken != "" {
+		query.Set("id_token_hint", idToken)
+	}
+	endSessionURL.RawQuery = query.Encode()
+
+	return endSessionURL.String(), nil
+}
+
+// EndSession logs the user out of the provider session. It listens on the loopback post logout
+// redirect URI, passes the end session URL to open and waits until the provider redirects back
+// with the state of the request, which confirms the logout.
+func EndSession(ctx context.Context, config Config, idToken string, open func(endSessionURL string)) error {
+	postLogoutRedirectURI := config.PostLogoutRedirectURI
+	if postLogoutRedirectURI == "" {
+		postLogoutRedirectURI = DefaultPostLogoutRedirectURI
+	}
+
+	listener, redirectURI, err := listenLoopback(postLogoutRedirectURI)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	state, err := randomString(16)
+	if err != nil {
+		return err
+	}
+
+	endSessionURL, err := BuildEndSessionURL(config, idToken, redirectURI, state)
+	if err != nil {
+		return err
+	}
+
+	_, err = awaitLoopbackCallback(ctx, listener, "Logout", state, func(url.Values) (string, error) {
+		return "", nil
+	}, func() {
+		open(endSessionURL)
+	})
+
+	return err
+}
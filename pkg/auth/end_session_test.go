@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEndSessionURL(t *testing.T) {
+	config := Config{ClientId: "client_id", EndSessionEndpoint: "https://idp.example.com/logout?tenant=corp"}
+
+	endSessionURL, err := BuildEndSessionURL(config, "id_token", "http://127.0.0.1:4711/logout", "state")
+	require.NoError(t, err)
+
+	u, err := url.Parse(endSessionURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/logout", u.Path)
+	assert.Equal(t, url.Values{
+		"tenant":                   []string{"corp"},
+		"client_id":                []string{"client_id"},
+		"id_token_hint":            []string{"id_token"},
+		"post_logout_redirect_uri": []string{"http://127.0.0.1:4711/logout"},
+		"state":                    []string{"state"},
+	}, u.Query())
+
+	_, err = BuildEndSessionURL(Config{}, "", "", "")
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestEndSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		forged bool
+	}{
+		{name: "confirmed"},
+		{name: "state mismatch is ignored", forged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				assert.Equal(t, "id_token", query.Get("id_token_hint"))
+
+				redirect, err := url.Parse(query.Get("post_logout_redirect_uri"))
+				assert.NoError(t, err)
+				redirect.RawQuery = url.Values{"state": []string{query.Get("state")}}.Encode()
+				http.Redirect(w, r, redirect.String(), http.StatusFound)
+			}))
+			defer provider.Close()
+
+			config := Config{ClientId: "client_id", EndSessionEndpoint: provider.URL + "/logout"}
+			err := EndSession(context.Background(), config, "id_token", func(endSessionURL string) {
+				go func() {
+					if tt.forged {
+						// A request with another state does not end the logout
+						u, err := url.Parse(endSessionURL)
+						if !assert.NoError(t, err) {
+							return
+						}
+						forged, err := http.Get(u.Query().Get("post_logout_redirect_uri") + "?state=other")
+						if assert.NoError(t, err) {
+							forged.Body.Close()
+							assert.Equal(t, http.StatusBadRequest, forged.StatusCode)
+						}
+					}
+
+					// Follow the redirects like the browser would
+					resp, err := http.Get(endSessionURL)
+					if assert.NoError(t, err) {
+						resp.Body.Close()
+					}
+				}()
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -15,4 +15,6 @@ var (
 	ErrInvalidScope         = errors.New("invalid scope requested")
 	ErrFileSaveFailed       = errors.New("failed to save token: permission denied")
 	ErrInternal             = errors.New("internal library error")
+	ErrAccessTokenExpired   = errors.New("access token expired")
+	ErrIssuerMismatch       = errors.New("issuer in the provider metadata does not match the configured issuer")
 )
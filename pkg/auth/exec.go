@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultExecEnv is the environment variable in which the exec command passes the access token.
+const DefaultExecEnv = "ACCESS_TOKEN"
+
+// forwardedSignals are the signals that the exec command forwards to the child process.
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// NewExecCommand creates a command that runs another command with the access token in its
+// environment. The token is refreshed before the command starts, and the user is asked to log
+// in first if needed and the session is interactive. The exit code of the command is propagated.
+func NewExecCommand(options ...Option) *cobra.Command {
+	var (
+		env      []string
+		resource string
+	)
+
+	cmd := &cobra.Command{
+		Use:         "exec -- command [args...]",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Run a command with the access token in its environment.",
+		Long: `The "exec" command runs a command with a valid access token in its environment, so that
+the token does not show up in your shell history. For example:
+
+  mycli exec --env TF_HTTP_PASSWORD -- terraform apply
+
+The token is exported as ACCESS_TOKEN unless other variables are given with --env.
+Signals are forwarded to the command, and its exit code is returned.
+`,
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, err := configureContext(cmd.Context(), options...)
+			if err != nil {
+				return commandError("failed to configure auth", err)
+			}
+
+			tokenSet, err := ensureToken(cmd, *authConfig, resource, isTerminal(os.Stdin))
+			if err != nil {
+				return commandError("failed to fetch token", err)
+			}
+
+			environment := os.Environ()
+			for _, name := range env {
+				environment = append(environment, name+"="+tokenSet.AccessToken)
+			}
+
+			code, err := runCommand(cmd.Context(), args, environment, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+			if err != nil {
+				return commandError("failed to run command", err)
+			}
+
+			if code != 0 {
+				// The command reported its own errors
+				cmd.SilenceErrors = true
+				return &Error{Code: code, Err: fmt.Errorf("command exited with code %d", code)}
+			}
+
+			return nil
+		},
+	}
+
+	// Flags after the command name belong to the command
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().StringSliceVar(&env, "env", []string{DefaultExecEnv}, "environment variables to export the access token as")
+	cmd.Flags().StringVar(&resource, "resource", "", "export a token restricted to the given resource indicator (RFC 8707)")
+
+	return cmd
+}
+
+// runCommand runs the command and returns its exit code. Signals received while the command is
+// running are forwarded to it. A command terminated by a signal exits with 128 plus the signal
+// number, like in a shell.
+func runCommand(ctx context.Context, args []string, env []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	child := exec.CommandContext(ctx, args[0], args[1:]...)
+	child.Env = env
+	child.Stdin = stdin
+	child.Stdout = stdout
+	child.Stderr = stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	if err := child.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				_ = child.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := child.Wait()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("waiting for command: %w", err)
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// notifyWriter closes ready on the first write.
+type notifyWriter struct {
+	ready chan struct{}
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.ready:
+	default:
+		close(w.ready)
+	}
+	return len(p), nil
+}
+
+func TestRunCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	t.Run("passes environment and output", func(t *testing.T) {
+		var stdout bytes.Buffer
+		code, err := runCommand(context.Background(), []string{"sh", "-c", `printf %s "$ACCESS_TOKEN"`}, []string{"ACCESS_TOKEN=access_token"}, nil, &stdout, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "access_token", stdout.String())
+	})
+
+	t.Run("propagates exit code", func(t *testing.T) {
+		code, err := runCommand(context.Background(), []string{"sh", "-c", "exit 3"}, nil, nil, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, code)
+	})
+
+	t.Run("forwards signals", func(t *testing.T) {
+		stdout := &notifyWriter{ready: make(chan struct{})}
+		go func() {
+			<-stdout.ready
+			process, err := os.FindProcess(os.Getpid())
+			assert.NoError(t, err)
+			assert.NoError(t, process.Signal(syscall.SIGTERM))
+		}()
+
+		code, err := runCommand(context.Background(), []string{"sh", "-c", `trap "exit 7" TERM; echo ready; sleep 5 >/dev/null & wait`}, nil, nil, stdout, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 7, code)
+	})
+
+	t.Run("reports signal termination", func(t *testing.T) {
+		code, err := runCommand(context.Background(), []string{"sh", "-c", "kill -KILL $$"}, nil, nil, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 128+int(syscall.SIGKILL), code)
+	})
+
+	t.Run("missing command", func(t *testing.T) {
+		_, err := runCommand(context.Background(), []string{"does-not-exist-command"}, nil, nil, nil, nil)
+		assert.Error(t, err)
+	})
+}
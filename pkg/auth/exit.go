@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/go-playground/validator"
+)
+
+// Exit codes of the commands. The host CLI maps errors returned by Execute to them with ExitCode:
+//
+//	if err := rootCmd.Execute(); err != nil {
+//		os.Exit(auth.ExitCode(err))
+//	}
+const (
+	// ExitCodeError is returned for errors without a more specific exit code.
+	ExitCodeError = 1
+	// ExitCodeConfig is returned if the configuration or the arguments of a command are invalid.
+	// Usage errors that cobra reports before a command runs, e.g. unknown flags or a wrong
+	// number of arguments, are not classified and map to ExitCodeError.
+	ExitCodeConfig = 3
+	// ExitCodeNotLoggedIn is returned if no token is stored or it can no longer be refreshed.
+	ExitCodeNotLoggedIn = 4
+	// ExitCodeExpired is returned if the token or the login attempt expired.
+	ExitCodeExpired = 5
+	// ExitCodeDenied is returned if the user denied the authorization or required scopes, or if
+	// the API rejected a request command with 401 or 403.
+	ExitCodeDenied = 6
+	// ExitCodeNetwork is returned if the OAuth2 provider or a server could not be reached, or if
+	// the API answered a request command with a server error.
+	ExitCodeNetwork = 7
+)
+
+// Error is the error returned by the commands. It carries the exit code for the host CLI.
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code for an error returned by a command: 0 for nil, the code of an
+// Error, and the code derived from the wrapped sentinel errors otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var commandErr *Error
+	if errors.As(err, &commandErr) {
+		return commandErr.Code
+	}
+
+	return classifyError(err)
+}
+
+// commandError wraps err with a message and its exit code.
+func commandError(message string, err error) error {
+	return &Error{
+		Code: classifyError(err),
+		Err:  fmt.Errorf("%s: %w", message, err),
+	}
+}
+
+// classifyError derives the exit code from the sentinel errors wrapped by err.
+func classifyError(err error) int {
+	var validationErrors validator.ValidationErrors
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, ErrInvalidConfig), errors.Is(err, ErrUnsupportedOutput), errors.Is(err, ErrURLNotAllowed), errors.Is(err, ErrIssuerMismatch), errors.As(err, &validationErrors):
+		return ExitCodeConfig
+	case errors.Is(err, ErrUserDenied), errors.Is(err, ErrInvalidScope):
+		return ExitCodeDenied
+	case errors.Is(err, ErrAccessTokenExpired), errors.Is(err, ErrTokenExpired):
+		return ExitCodeExpired
+	case loginRequired(err):
+		return ExitCodeNotLoggedIn
+	case errors.Is(err, ErrHTTPFailure), errors.As(err, &netErr):
+		return ExitCodeNetwork
+	default:
+		return ExitCodeError
+	}
+}
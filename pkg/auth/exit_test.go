@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: 0},
+		{name: "command error", err: &Error{Code: 42, Err: errors.New("failed")}, want: 42},
+		{name: "wrapped command error", err: fmt.Errorf("wrapped: %w", &Error{Code: 42, Err: errors.New("failed")}), want: 42},
+		{name: "invalid config", err: fmt.Errorf("%w: missing", ErrInvalidConfig), want: ExitCodeConfig},
+		{name: "not logged in", err: fmt.Errorf("%w: no refresh token", storage.ErrTokenNotFound), want: ExitCodeNotLoggedIn},
+		{name: "refresh rejected", err: ErrInvalidTokenResponse, want: ExitCodeNotLoggedIn},
+		{name: "access token expired", err: ErrAccessTokenExpired, want: ExitCodeExpired},
+		{name: "device code expired", err: ErrTokenExpired, want: ExitCodeExpired},
+		{name: "denied", err: ErrUserDenied, want: ExitCodeDenied},
+		{name: "http failure", err: errors.Join(ErrHTTPFailure, errors.New("connection refused")), want: ExitCodeNetwork},
+		{name: "net error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: ExitCodeNetwork},
+		{name: "other", err: errors.New("failed"), want: ExitCodeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ExitCode(tt.err))
+		})
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	options := func(provider storage.StorageProvider) []Option {
+		return []Option{
+			WithClientID("client_id"),
+			WithDeviceAuthorizationEndpoint("https://example.com/device"),
+			WithTokenEndpoint("https://example.com/token"),
+			WithStorageProvider(provider),
+		}
+	}
+
+	execute := func(t *testing.T, options []Option, args ...string) error {
+		cmd := NewTokenCommand(options...)
+		cmd.SetArgs(args)
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		return cmd.Execute()
+	}
+
+	t.Run("not logged in", func(t *testing.T) {
+		err := execute(t, options(storage.NewMemoryStorage("test")))
+		assert.Equal(t, ExitCodeNotLoggedIn, ExitCode(err))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		provider := newTestStorage(t, TokenSet{AccessToken: "access_token", Expiry: time.Now().Add(10 * time.Minute)})
+
+		// Without refresh token the stored token is used while it is valid
+		assert.NoError(t, execute(t, options(provider)))
+
+		err := execute(t, options(provider), "--min-valid", "1h")
+		assert.Equal(t, ExitCodeExpired, ExitCode(err))
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		err := execute(t, []Option{WithClientID("client_id")})
+		assert.Equal(t, ExitCodeConfig, ExitCode(err))
+	})
+
+	t.Run("unsupported output", func(t *testing.T) {
+		provider := newTestStorage(t, TokenSet{AccessToken: "access_token"})
+
+		err := execute(t, options(provider), "--output", "yaml")
+		assert.Equal(t, ExitCodeConfig, ExitCode(err))
+	})
+}
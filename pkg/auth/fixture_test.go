@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestStorage returns a memory storage provider that holds tokenSet as the login token set.
+func newTestStorage(t *testing.T, tokenSet TokenSet) storage.StorageProvider {
+	provider := storage.NewMemoryStorage("test")
+	assert.NoError(t, SaveTokenSet(provider, tokenSet))
+	return provider
+}
+
+// newTestConfig returns the configuration of a device code client that is logged in with tokenSet
+// and refreshes it at tokenEndpoint.
+func newTestConfig(t *testing.T, tokenEndpoint string, tokenSet TokenSet) Config {
+	return Config{
+		ClientId:                    "client_id",
+		DeviceAuthorizationEndpoint: "https://example.com/device",
+		TokenEndpoint:               tokenEndpoint,
+		StorageProvider:             newTestStorage(t, tokenSet),
+		GrantType:                   DeviceCode,
+	}
+}
+
+// newTestTokenManager returns a token manager of the login token set of newTestConfig.
+func newTestTokenManager(t *testing.T, tokenEndpoint string, tokenSet TokenSet) *TokenManager {
+	return newTokenManager(newTestConfig(t, tokenEndpoint, tokenSet), "")
+}
+
+// newRefreshServer returns a token endpoint that answers refresh requests with the given access token.
+func newRefreshServer(t *testing.T, accessToken string, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, RefreshToken.String(), r.PostForm.Get("grant_type"))
+
+		if _, err := w.Write([]byte(`{"access_token":"` + accessToken + `","token_type":"bearer","expires_in":3600}`)); err != nil {
+			t.Errorf("failed to write: %v", err)
+		}
+	}))
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// grantTypeNames maps the short names accepted by ParseGrantType to the grant types.
+var grantTypeNames = map[string]GrantType{
+	"device_code":        DeviceCode,
+	"authorization_code": AuthorizationCode,
+	"client_credentials": ClientCredentials,
+	"ciba":               CIBA,
+}
+
+// ParseGrantType parses a grant type given by its short name, e.g. "device_code", or its
+// grant_type value.
+func ParseGrantType(value string) (GrantType, error) {
+	name := strings.ReplaceAll(strings.ToLower(value), "-", "_")
+	if grantType, ok := grantTypeNames[name]; ok {
+		return grantType, nil
+	}
+
+	for _, grantType := range grantTypeNames {
+		if grantType.String() == value {
+			return grantType, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: unsupported grant type %s", ErrInvalidConfig, value)
+}
+
+// BindFlags adds flags for the configuration to flags and returns an Option that applies
+// their values. The flags are:
+//
+//	--client-id, --issuer, --scopes, --audience, --grant-type, --token-endpoint,
+//	--authorization-endpoint, --device-authorization-endpoint, --redirect-uri, --resources,
+//	--login-hint, --binding-message, --profile
+//
+// If envPrefix is not empty, each flag falls back to an environment variable named after the
+// prefix and the flag, e.g. MYCLI_CLIENT_ID for the prefix "MYCLI". The client secret can only
+// be set with the environment variable <prefix>_CLIENT_SECRET, so that it does not show up in
+// the process list.
+//
+// Values are applied in the order flag, environment variable, configuration file (see
+// WithConfigFile), options in code and defaults, regardless of the position of the returned
+// Option. If the issuer is set by a flag or an environment variable, the endpoints configured
+// in code are discarded and discovered from the issuer, unless they are set by flags or
+// environment variables as well.
+//
+// Flags that already exist in flags, e.g. from an earlier call of BindFlags with the same flag
+// set, are reused instead of being added again.
+func BindFlags(flags *pflag.FlagSet, envPrefix string) Option {
+	binder := &flagBinder{flags: flags, envPrefix: envPrefix}
+
+	binder.string("client-id", "OAuth2 client ID", func(c *Config, value string) {
+		c.ClientId = value
+	})
+	binder.env("client-secret", func(c *Config, value string) {
+		c.ClientSecret = value
+	})
+	binder.string("issuer", "issuer URL of the OAuth2 provider, used to discover its endpoints", func(c *Config, value string) {
+		c.setIssuer(value)
+	})
+	binder.strings("scopes", "scopes to request", func(c *Config, values []string) {
+		c.Scopes = values
+	})
+	binder.string("audience", "audience of the access token", func(c *Config, value string) {
+		c.Audience = value
+	})
+	binder.string("grant-type", "grant type used to log in: device_code, authorization_code, client_credentials or ciba", func(c *Config, value string) {
+		grantType, err := ParseGrantType(value)
+		if err != nil {
+			// Reported by Config.IsValid
+			grantType = GrantType(value)
+		}
+		c.GrantType = grantType
+	})
+	binder.string("token-endpoint", "token endpoint URL", func(c *Config, value string) {
+		c.TokenEndpoint = value
+	})
+	binder.string("authorization-endpoint", "authorization endpoint URL", func(c *Config, value string) {
+		c.AuthorizationEndpoint = value
+	})
+	binder.string("device-authorization-endpoint", "device authorization endpoint URL", func(c *Config, value string) {
+		c.DeviceAuthorizationEndpoint = value
+	})
+	binder.string("redirect-uri", "loopback redirect URI of the authorization code grant", func(c *Config, value string) {
+		c.RedirectURI = value
+	})
+	binder.strings("resources", "resource indicators (RFC 8707) to request", func(c *Config, values []string) {
+		c.Resources = values
+	})
+	binder.string("login-hint", "user to authenticate with the ciba grant, e.g. an email address", func(c *Config, value string) {
+		c.LoginHint = value
+	})
+	binder.string("binding-message", "message shown on the device of the user by the ciba grant", func(c *Config, value string) {
+		c.BindingMessage = value
+	})
+	binder.string("profile", "profile of the configuration file to use", func(c *Config, value string) {
+		c.Profile = value
+	})
+
+	return func(c *Config) {
+		c.overrides = append(c.overrides, binder.apply)
+	}
+}
+
+// flagBinder collects the configuration values set by flags and environment variables.
+type flagBinder struct {
+	flags     *pflag.FlagSet
+	envPrefix string
+	bindings  []func(c *Config)
+}
+
+// apply sets the configuration values in the order in which the flags were bound.
+func (b *flagBinder) apply(c *Config) {
+	for _, bind := range b.bindings {
+		bind(c)
+	}
+}
+
+func (b *flagBinder) string(name, usage string, set func(c *Config, value string)) {
+	if b.flags.Lookup(name) == nil {
+		b.flags.String(name, "", b.usage(name, usage))
+	}
+	b.bindings = append(b.bindings, func(c *Config) {
+		if b.flags.Changed(name) {
+			set(c, b.flags.Lookup(name).Value.String())
+		} else if env, ok := b.lookupEnv(name); ok {
+			set(c, env)
+		}
+	})
+}
+
+func (b *flagBinder) strings(name, usage string, set func(c *Config, values []string)) {
+	if b.flags.Lookup(name) == nil {
+		b.flags.StringSlice(name, nil, b.usage(name, usage))
+	}
+	b.bindings = append(b.bindings, func(c *Config) {
+		if b.flags.Changed(name) {
+			values, err := b.flags.GetStringSlice(name)
+			if err != nil {
+				// A flag of another type that was added before
+				values = splitList(b.flags.Lookup(name).Value.String())
+			}
+			set(c, values)
+		} else if env, ok := b.lookupEnv(name); ok {
+			// Lists in environment variables are separated by commas or spaces
+			set(c, splitList(env))
+		}
+	})
+}
+
+// env binds a value that can only be set with an environment variable.
+func (b *flagBinder) env(name string, set func(c *Config, value string)) {
+	b.bindings = append(b.bindings, func(c *Config) {
+		if env, ok := b.lookupEnv(name); ok {
+			set(c, env)
+		}
+	})
+}
+
+// lookupEnv returns the non-empty value of the environment variable of the flag.
+func (b *flagBinder) lookupEnv(name string) (string, bool) {
+	if b.envPrefix == "" {
+		return "", false
+	}
+
+	value := os.Getenv(b.envName(name))
+	return value, value != ""
+}
+
+func (b *flagBinder) envName(name string) string {
+	return strings.ToUpper(b.envPrefix + "_" + strings.ReplaceAll(name, "-", "_"))
+}
+
+func (b *flagBinder) usage(name, usage string) string {
+	if b.envPrefix == "" {
+		return usage
+	}
+	return fmt.Sprintf("%s (env %s)", usage, b.envName(name))
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGrantType(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    GrantType
+		wantErr bool
+	}{
+		{value: "device_code", want: DeviceCode},
+		{value: "device-code", want: DeviceCode},
+		{value: "urn:ietf:params:oauth:grant-type:device_code", want: DeviceCode},
+		{value: "authorization_code", want: AuthorizationCode},
+		{value: "Client_Credentials", want: ClientCredentials},
+		{value: "password", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			grantType, err := ParseGrantType(tt.value)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidConfig)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, grantType)
+		})
+	}
+}
+
+func TestBindFlags(t *testing.T) {
+	configureWithFlags := func(t *testing.T, args []string) (*Config, error) {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		bind := BindFlags(flags, "MYCLI")
+		assert.NoError(t, flags.Parse(args))
+
+		// The bound flags take precedence over options that come after them
+		return configure(
+			bind,
+			WithClientID("code_client"),
+			WithDeviceAuthorizationEndpoint("https://code.example.com/device"),
+			WithTokenEndpoint("https://code.example.com/token"),
+			WithScopes([]string{"openid"}),
+			WithStorageProvider(storage.NewMemoryStorage("test")),
+		)
+	}
+
+	t.Run("options in code", func(t *testing.T) {
+		config, err := configureWithFlags(t, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "code_client", config.ClientId)
+		assert.Equal(t, []string{"openid"}, config.Scopes)
+	})
+
+	t.Run("environment variables", func(t *testing.T) {
+		t.Setenv("MYCLI_CLIENT_ID", "env_client")
+		t.Setenv("MYCLI_CLIENT_SECRET", "env_secret")
+		t.Setenv("MYCLI_SCOPES", "openid, profile admin")
+
+		config, err := configureWithFlags(t, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "env_client", config.ClientId)
+		assert.Equal(t, "env_secret", config.ClientSecret)
+		assert.Equal(t, []string{"openid", "profile", "admin"}, config.Scopes)
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		t.Setenv("MYCLI_CLIENT_ID", "env_client")
+
+		config, err := configureWithFlags(t, []string{
+			"--client-id", "flag_client",
+			"--scopes", "read,write",
+			"--audience", "https://api.example.com",
+			"--grant-type", "client_credentials",
+			"--token-endpoint", "https://flag.example.com/token",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "flag_client", config.ClientId)
+		assert.Equal(t, []string{"read", "write"}, config.Scopes)
+		assert.Equal(t, "https://api.example.com", config.Audience)
+		assert.Equal(t, ClientCredentials, config.GrantType)
+		assert.Equal(t, "https://flag.example.com/token", config.TokenEndpoint)
+		assert.Equal(t, "https://code.example.com/device", config.DeviceAuthorizationEndpoint)
+	})
+
+	t.Run("invalid grant type", func(t *testing.T) {
+		_, err := configureWithFlags(t, []string{"--grant-type", "password"})
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	})
+
+	t.Run("issuer replaces endpoints from code", func(t *testing.T) {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/tenant/.well-known/openid-configuration", r.URL.Path)
+			assert.NoError(t, json.NewEncoder(w).Encode(AuthorizationServerMetadataResponse{
+				Issuer:                      server.URL + "/tenant",
+				TokenEndpoint:               server.URL + "/tenant/token",
+				DeviceAuthorizationEndpoint: server.URL + "/tenant/device",
+			}))
+		}))
+		defer server.Close()
+
+		t.Setenv("MYCLI_ISSUER", server.URL+"/tenant")
+
+		config, err := configureWithFlags(t, []string{"--device-authorization-endpoint", "https://flag.example.com/device"})
+		assert.NoError(t, err)
+		assert.Equal(t, server.URL+"/tenant/token", config.TokenEndpoint)
+		assert.Equal(t, "https://flag.example.com/device", config.DeviceAuthorizationEndpoint)
+	})
+}
+
+func TestBindFlagsTwice(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	first := BindFlags(flags, "MYCLI")
+	second := BindFlags(flags, "MYCLI")
+	assert.NoError(t, flags.Parse([]string{"--client-id", "flag_client", "--scopes", "openid,admin"}))
+
+	for _, bind := range []Option{first, second} {
+		config := newConfig([]Option{bind})
+		assert.Equal(t, "flag_client", config.ClientId)
+		assert.Equal(t, []string{"openid", "admin"}, config.Scopes)
+	}
+}
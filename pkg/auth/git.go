@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// gitCredential holds the attributes of the Git credential helper protocol. Attributes are
+// exchanged as key=value lines, terminated by an empty line or the end of the input.
+type gitCredential map[string]string
+
+// NewGitCredentialCommand creates a command that implements the Git credential helper protocol.
+// Git receives the access token as password for HTTPS remotes on the hosts configured with
+// WithGitHosts. Unless a profile is selected, the profile of the configuration file with the host
+// of the remote in its git_hosts is used. The token is refreshed when it is about to expire or
+// was rejected by the server.
+func NewGitCredentialCommand(options ...Option) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "git-credential",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Provide the access token to Git as a credential helper.",
+		Long: `The "git-credential" command implements the Git credential helper protocol, so that Git
+authenticates with the access token at the configured hosts. Configure it for a host with:
+
+  git config --global credential.https://git.example.com.helper "!mycli git-credential"
+
+Log in with the login command before using Git.
+`,
+	}
+
+	cmd.AddCommand(
+		newGitCredentialCommand("get", "Print the credentials of a remote.", options, gitGet),
+		newGitCredentialCommand("store", "Accept credentials that were used successfully.", options, gitStore),
+		newGitCredentialCommand("erase", "Refresh the access token after it was rejected.", options, gitErase),
+	)
+
+	return cmd
+}
+
+// newGitCredentialCommand creates a subcommand of the credential helper.
+func newGitCredentialCommand(use, short string, options []Option, handle func(ctx context.Context, config Config, credential gitCredential, out io.Writer) error) *cobra.Command {
+	return &cobra.Command{
+		Use:          use,
+		Short:        short,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			credential, err := readGitCredential(cmd.InOrStdin())
+			if err != nil {
+				return commandError("failed to read credential", err)
+			}
+
+			profile, err := gitProfile(options, credential)
+			if err != nil {
+				return commandError("failed to load configuration file", err)
+			}
+
+			gitOptions := options
+			if profile != "" {
+				gitOptions = append(slices.Clip(options), WithProfile(profile))
+			}
+
+			authConfig, err := configureContext(cmd.Context(), gitOptions...)
+			if err != nil {
+				return commandError("failed to configure auth", err)
+			}
+
+			if err := handle(cmd.Context(), *authConfig, credential, cmd.OutOrStdout()); err != nil {
+				return commandError("credential helper failed", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// gitGet writes the access token for a configured host. For other hosts nothing is written, so
+// that Git asks the next credential helper.
+func gitGet(ctx context.Context, config Config, credential gitCredential, out io.Writer) error {
+	if !isGitHost(config, credential) {
+		return nil
+	}
+
+	tokenSet, err := fetchToken(ctx, config, tokenRequest{minValid: DefaultExpiryDelta})
+	if err != nil {
+		if loginRequired(err) {
+			return fmt.Errorf("not logged in, run the login command first: %w", err)
+		}
+		return err
+	}
+
+	username := config.GitUsername
+	if username == "" {
+		username = DefaultGitUsername
+	}
+
+	response := gitCredential{
+		"username": username,
+		"password": tokenSet.AccessToken,
+	}
+	if !tokenSet.Expiry.IsZero() {
+		response["password_expiry_utc"] = strconv.FormatInt(tokenSet.Expiry.Unix(), 10)
+	}
+
+	return writeGitCredential(out, response)
+}
+
+// gitStore accepts credentials that Git used successfully. They are not stored, since the
+// access token is issued by the OAuth2 provider.
+func gitStore(context.Context, Config, gitCredential, io.Writer) error {
+	return nil
+}
+
+// gitErase refreshes the access token after the server rejected it, so that the next request of
+// Git receives a new one. The login token is kept, use the logout command to remove it.
+func gitErase(ctx context.Context, config Config, credential gitCredential, _ io.Writer) error {
+	if !isGitHost(config, credential) || credential["password"] == "" {
+		return nil
+	}
+
+	_, err := fetchToken(ctx, config, tokenRequest{
+		minValid: DefaultExpiryDelta,
+		rejected: credential["password"],
+	})
+	if err != nil && !loginRequired(err) {
+		return err
+	}
+	return nil
+}
+
+// isGitHost reports whether the credential refers to an HTTPS remote on a configured host.
+func isGitHost(config Config, credential gitCredential) bool {
+	if credential["protocol"] != "https" {
+		return false
+	}
+
+	for _, host := range config.GitHosts {
+		if strings.EqualFold(urlHost(host), credential["host"]) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitProfile returns the profile of the configuration file with the host of the remote in its
+// git_hosts. It returns an empty name if a profile is selected explicitly or the selected
+// profile serves the host, so that the selection is kept.
+func gitProfile(options []Option, credential gitCredential) (string, error) {
+	authConfig := newConfig(options)
+	if authConfig.ConfigFile == "" || authConfig.Profile != "" {
+		return "", nil
+	}
+
+	file, err := LoadConfigFile(authConfig.ConfigFile)
+	if err != nil {
+		return "", err
+	}
+
+	servesHost := func(profile string) bool {
+		hosts, _ := file.Get(profile, "git_hosts")
+		return isGitHost(Config{GitHosts: profileList(hosts)}, credential)
+	}
+
+	if servesHost("") {
+		return "", nil
+	}
+
+	for _, profile := range slices.Sorted(maps.Keys(file.Profiles)) {
+		if servesHost(profile) {
+			return profile, nil
+		}
+	}
+
+	return "", nil
+}
+
+// readGitCredential reads the attributes sent by Git.
+func readGitCredential(in io.Reader) (gitCredential, error) {
+	credential := gitCredential{}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		credential[key] = value
+	}
+
+	return credential, scanner.Err()
+}
+
+// writeGitCredential writes the attributes for Git.
+func writeGitCredential(out io.Writer, credential gitCredential) error {
+	for _, key := range []string{"username", "password", "password_expiry_utc"} {
+		if value, ok := credential[key]; ok {
+			if _, err := fmt.Fprintf(out, "%s=%s\n", key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
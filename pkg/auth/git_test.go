@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadGitCredential(t *testing.T) {
+	credential, err := readGitCredential(strings.NewReader("protocol=https\nhost=git.example.com:8443\npath=org/repo.git\n\nignored=true\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, gitCredential{
+		"protocol": "https",
+		"host":     "git.example.com:8443",
+		"path":     "org/repo.git",
+	}, credential)
+
+	_, err = readGitCredential(strings.NewReader("invalid\n"))
+	assert.Error(t, err)
+}
+
+func TestGitGet(t *testing.T) {
+	expiry := time.Now().Add(time.Hour)
+	config := newTestConfig(t, "https://example.com/token", TokenSet{AccessToken: "access_token", Expiry: expiry})
+	config.GitHosts = []string{"git.example.com", "https://other.example.com:8443"}
+
+	tests := []struct {
+		name       string
+		credential gitCredential
+		want       string
+	}{
+		{
+			name:       "configured host",
+			credential: gitCredential{"protocol": "https", "host": "git.example.com"},
+			want:       "username=oauth2\npassword=access_token\npassword_expiry_utc=" + strconv.FormatInt(expiry.Unix(), 10) + "\n",
+		},
+		{
+			name:       "configured host with port",
+			credential: gitCredential{"protocol": "https", "host": "other.example.com:8443"},
+			want:       "username=oauth2\npassword=access_token\npassword_expiry_utc=" + strconv.FormatInt(expiry.Unix(), 10) + "\n",
+		},
+		{
+			name:       "other host",
+			credential: gitCredential{"protocol": "https", "host": "github.com"},
+		},
+		{
+			name:       "plain http",
+			credential: gitCredential{"protocol": "http", "host": "git.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.NoError(t, gitGet(context.Background(), config, tt.credential, &out))
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestGitErase(t *testing.T) {
+	var refreshes atomic.Int32
+	tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+	defer tokenServer.Close()
+
+	config := newTestConfig(t, tokenServer.URL, TokenSet{
+		AccessToken:  "rejected",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(time.Hour),
+	})
+	config.GitHosts = []string{"git.example.com"}
+	config.GitUsername = "x-access-token"
+
+	// Erasing credentials of other hosts does not refresh the token
+	assert.NoError(t, gitErase(context.Background(), config, gitCredential{"protocol": "https", "host": "github.com", "password": "rejected"}, nil))
+	assert.Equal(t, int32(0), refreshes.Load())
+
+	assert.NoError(t, gitErase(context.Background(), config, gitCredential{"protocol": "https", "host": "git.example.com", "password": "rejected"}, nil))
+	assert.Equal(t, int32(1), refreshes.Load())
+
+	var out bytes.Buffer
+	assert.NoError(t, gitGet(context.Background(), config, gitCredential{"protocol": "https", "host": "git.example.com"}, &out))
+	assert.Contains(t, out.String(), "username=x-access-token\npassword=refreshed\n")
+	assert.Equal(t, int32(1), refreshes.Load())
+}
+
+func TestGitCredentialSelectsProfile(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `current_profile: public
+profiles:
+  public:
+    git_hosts: [git.example.com]
+    git_username: public
+  internal:
+    git_hosts: [git.internal.example.com]
+    git_username: internal
+`)
+	provider := storage.NewMemoryStorage("test")
+	options := []Option{
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(provider),
+		WithConfigFile(path),
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		profile string
+		want    string
+	}{
+		{name: "current profile", host: "git.example.com", want: "public"},
+		{name: "profile of the host", host: "git.internal.example.com", want: "internal"},
+		{name: "selected profile", host: "git.internal.example.com", profile: "public"},
+		{name: "other host", host: "github.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testOptions := options
+			if tt.profile != "" {
+				testOptions = append(slices.Clip(options), WithProfile(tt.profile))
+			}
+			if tt.want != "" {
+				config, err := configure(append(slices.Clip(options), WithProfile(tt.want))...)
+				assert.NoError(t, err)
+				assert.NoError(t, SaveTokenSet(config.StorageProvider, TokenSet{AccessToken: "access_token"}))
+			}
+
+			var out bytes.Buffer
+			cmd := NewGitCredentialCommand(testOptions...)
+			cmd.SetIn(strings.NewReader("protocol=https\nhost=" + tt.host + "\n\n"))
+			cmd.SetOut(&out)
+			cmd.SetArgs([]string{"get"})
+			assert.NoError(t, cmd.Execute())
+
+			if tt.want == "" {
+				assert.Empty(t, out.String())
+			} else {
+				assert.Equal(t, "username="+tt.want+"\npassword=access_token\n", out.String())
+			}
+		})
+	}
+}
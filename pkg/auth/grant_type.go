@@ -8,8 +8,16 @@ const (
 	DeviceCode        GrantType = "urn:ietf:params:oauth:grant-type:device_code"
 	Password          GrantType = "password"
 	RefreshToken      GrantType = "refresh_token"
+	// CIBA is the OpenID Connect Client-Initiated Backchannel Authentication grant.
+	CIBA GrantType = "urn:openid:params:grant-type:ciba"
 )
 
 func (g GrantType) String() string {
 	return string(g)
 }
+
+// needsUser reports whether the grant needs the user to take part in the login. Tokens of the
+// other grants are obtained without a terminal.
+func (g GrantType) needsUser() bool {
+	return g != ClientCredentials
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/browser"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// kubeExecInfoEnv is the environment variable in which client-go passes the ExecCredential
+	// request to the credential plugin.
+	kubeExecInfoEnv = "KUBERNETES_EXEC_INFO"
+
+	kubeExecCredentialAPIVersion = "client.authentication.k8s.io/v1"
+	kubeExecCredentialKind       = "ExecCredential"
+)
+
+// execCredential is the ExecCredential object exchanged with client-go credential plugins.
+type execCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Spec       *execCredentialSpec   `json:"spec,omitempty"`
+	Status     *execCredentialStatus `json:"status,omitempty"`
+}
+
+type execCredentialSpec struct {
+	Interactive bool `json:"interactive"`
+}
+
+type execCredentialStatus struct {
+	Token               string `json:"token"`
+	ExpirationTimestamp string `json:"expirationTimestamp,omitempty"`
+}
+
+// NewKubeCredentialCommand creates a command that acts as a client-go exec credential plugin.
+// It prints an ExecCredential with the stored access token, refreshing it if needed. If the user
+// has to log in and client-go reports an interactive session, the configured login flow is run
+// with its instructions on stderr.
+func NewKubeCredentialCommand(options ...Option) *cobra.Command {
+	return &cobra.Command{
+		Use:         "kube-credential",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Print a Kubernetes ExecCredential with the current access token.",
+		Long: `The "kube-credential" command implements the client-go exec credential plugin protocol,
+so that kubectl authenticates with your OAuth2 provider. Configure it in your kubeconfig:
+
+  users:
+  - name: oauth2
+    user:
+      exec:
+        apiVersion: client.authentication.k8s.io/v1
+        command: mycli
+        args: ["kube-credential"]
+        interactiveMode: IfAvailable
+
+If no valid token is stored and the session is interactive, you are asked to log in.
+`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, err := configureContext(cmd.Context(), options...)
+			if err != nil {
+				return commandError("failed to configure auth", err)
+			}
+
+			request, err := kubeExecInfo()
+			if err != nil {
+				return commandError("failed to read "+kubeExecInfoEnv, err)
+			}
+
+			if request.Spec.Interactive {
+				// Standard output is reserved for the ExecCredential. The browser package writes
+				// to a global, so restore it for other commands of the process.
+				stdout := browser.Stdout
+				browser.Stdout = cmd.ErrOrStderr()
+				defer func() {
+					browser.Stdout = stdout
+				}()
+			}
+
+			tokenSet, err := ensureToken(cmd, *authConfig, "", request.Spec.Interactive)
+			if err != nil {
+				return commandError("failed to fetch token", err)
+			}
+
+			response := execCredential{
+				APIVersion: request.APIVersion,
+				Kind:       kubeExecCredentialKind,
+				Status:     &execCredentialStatus{Token: tokenSet.AccessToken},
+			}
+			if !tokenSet.Expiry.IsZero() {
+				response.Status.ExpirationTimestamp = tokenSet.Expiry.UTC().Format(time.RFC3339)
+			}
+
+			if err := json.NewEncoder(cmd.OutOrStdout()).Encode(response); err != nil {
+				return commandError("failed to write credential", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// kubeExecInfo returns the ExecCredential request passed by client-go. Without a request, e.g.
+// when the command is run manually, the session is considered interactive.
+func kubeExecInfo() (*execCredential, error) {
+	request := &execCredential{
+		APIVersion: kubeExecCredentialAPIVersion,
+		Kind:       kubeExecCredentialKind,
+		Spec:       &execCredentialSpec{Interactive: true},
+	}
+
+	value := os.Getenv(kubeExecInfoEnv)
+	if value == "" {
+		return request, nil
+	}
+
+	request = &execCredential{}
+	if err := json.Unmarshal([]byte(value), request); err != nil {
+		return nil, err
+	}
+
+	switch request.APIVersion {
+	case kubeExecCredentialAPIVersion, "client.authentication.k8s.io/v1beta1":
+	default:
+		return nil, fmt.Errorf("unsupported api version %q", request.APIVersion)
+	}
+
+	if request.Spec == nil {
+		request.Spec = &execCredentialSpec{}
+	}
+
+	return request, nil
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/pkg/browser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubeCredentialCommand(t *testing.T) {
+	t.Setenv(kubeExecInfoEnv, `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","spec":{"interactive":false}}`)
+
+	provider := storage.NewMemoryStorage("test")
+	expiry := time.Now().Add(time.Hour)
+	assert.NoError(t, SaveTokenSet(provider, TokenSet{AccessToken: "access_token", Expiry: expiry}))
+
+	cmd := NewKubeCredentialCommand(
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(provider),
+	)
+
+	var stdout bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetArgs([]string{})
+	assert.NoError(t, cmd.Execute())
+
+	var credential execCredential
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &credential))
+	assert.Equal(t, "client.authentication.k8s.io/v1", credential.APIVersion)
+	assert.Equal(t, "ExecCredential", credential.Kind)
+	assert.Equal(t, "access_token", credential.Status.Token)
+	assert.Equal(t, expiry.UTC().Format(time.RFC3339), credential.Status.ExpirationTimestamp)
+}
+
+func TestKubeCredentialCommandRestoresBrowserOutput(t *testing.T) {
+	t.Setenv(kubeExecInfoEnv, `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","spec":{"interactive":true}}`)
+
+	provider := newTestStorage(t, TokenSet{AccessToken: "access_token", Expiry: time.Now().Add(time.Hour)})
+
+	cmd := NewKubeCredentialCommand(
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(provider),
+	)
+
+	stdout := browser.Stdout
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, stdout, browser.Stdout)
+}
+
+func TestKubeCredentialCommandRefreshesExpiringToken(t *testing.T) {
+	t.Setenv(kubeExecInfoEnv, `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","spec":{"interactive":false}}`)
+
+	var refreshes atomic.Int32
+	tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+	defer tokenServer.Close()
+
+	// The token is still valid, but would expire while kubectl uses it
+	provider := newTestStorage(t, TokenSet{
+		AccessToken:  "expiring",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(10 * time.Second),
+	})
+
+	cmd := NewKubeCredentialCommand(
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint(tokenServer.URL),
+		WithStorageProvider(provider),
+	)
+
+	var stdout bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetArgs([]string{})
+	assert.NoError(t, cmd.Execute())
+
+	var credential execCredential
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &credential))
+	assert.Equal(t, "refreshed", credential.Status.Token)
+	assert.Equal(t, int32(1), refreshes.Load())
+}
+
+func TestKubeExecInfo(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		apiVersion  string
+		interactive bool
+		wantErr     bool
+	}{
+		{
+			name:        "not set",
+			apiVersion:  "client.authentication.k8s.io/v1",
+			interactive: true,
+		},
+		{
+			name:        "interactive",
+			value:       `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","spec":{"interactive":true}}`,
+			apiVersion:  "client.authentication.k8s.io/v1",
+			interactive: true,
+		},
+		{
+			name:       "non-interactive v1beta1",
+			value:      `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","spec":{"interactive":false}}`,
+			apiVersion: "client.authentication.k8s.io/v1beta1",
+		},
+		{
+			name:    "unsupported api version",
+			value:   `{"apiVersion":"client.authentication.k8s.io/v1alpha1","kind":"ExecCredential"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			value:   `{`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(kubeExecInfoEnv, tt.value)
+
+			request, err := kubeExecInfo()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.apiVersion, request.APIVersion)
+			assert.Equal(t, tt.interactive, request.Spec.Interactive)
+		})
+	}
+}
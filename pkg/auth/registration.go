@@ -0,0 +1,465 @@
+package auth
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// registrationStorageKey is the storage key of the registration secrets of a profile.
+const registrationStorageKey = "registration"
+
+// ClientMetadata is the metadata of a client registered with dynamic client registration
+// (RFC 7591).
+type ClientMetadata struct {
+	ClientName              string   `json:"client_name,omitempty"`
+	ApplicationType         string   `json:"application_type,omitempty"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+}
+
+// ClientRegistration is the information about a registered client returned by the provider.
+type ClientRegistration struct {
+	ClientMetadata
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at,omitempty"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri,omitempty"`
+}
+
+// registrationErrorResponse is the error response of the registration endpoints.
+type registrationErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NativeClientMetadata returns the metadata of a native public client (RFC 8252) for the
+// configuration: the loopback redirect URI, the configured grant type with refresh tokens and
+// no client authentication at the token endpoint.
+func NativeClientMetadata(config Config, clientName string) (*ClientMetadata, error) {
+	metadata := &ClientMetadata{
+		ClientName:              clientName,
+		ApplicationType:         "native",
+		GrantTypes:              []string{config.GrantType.String(), RefreshToken.String()},
+		TokenEndpointAuthMethod: "none",
+		Scope:                   joinScopes(config.Scopes),
+	}
+
+	switch config.GrantType {
+	case AuthorizationCode:
+		redirectURI := config.RedirectURI
+		if redirectURI == "" {
+			redirectURI = DefaultRedirectURI
+		}
+		metadata.RedirectURIs = []string{redirectURI}
+		metadata.ResponseTypes = []string{"code"}
+	case DeviceCode:
+	default:
+		return nil, fmt.Errorf("%w: the %s grant cannot be used by a public client", ErrInvalidConfig, grantTypeName(config.GrantType))
+	}
+
+	return metadata, nil
+}
+
+// RegisterClient registers a client at the registration endpoint (RFC 7591). The initial access
+// token is only sent if it is not empty.
+func RegisterClient(ctx context.Context, registrationEndpoint string, metadata ClientMetadata, initialAccessToken string) (*ClientRegistration, error) {
+	return sendRegistrationRequest(ctx, http.MethodPost, registrationEndpoint, initialAccessToken, metadata, http.StatusCreated)
+}
+
+// ReadClient reads the current registration of the client from its client configuration
+// endpoint (RFC 7592).
+func ReadClient(ctx context.Context, registration ClientRegistration) (*ClientRegistration, error) {
+	return sendRegistrationRequest(ctx, http.MethodGet, registration.RegistrationClientURI, registration.RegistrationAccessToken, nil, http.StatusOK)
+}
+
+// UpdateClient replaces the metadata of the registered client (RFC 7592). The returned
+// registration may carry a new registration access token.
+func UpdateClient(ctx context.Context, registration ClientRegistration, metadata ClientMetadata) (*ClientRegistration, error) {
+	body := struct {
+		ClientMetadata
+		ClientID string `json:"client_id"`
+	}{metadata, registration.ClientID}
+
+	return sendRegistrationRequest(ctx, http.MethodPut, registration.RegistrationClientURI, registration.RegistrationAccessToken, body, http.StatusOK)
+}
+
+// DeleteClient deletes the registered client (RFC 7592).
+func DeleteClient(ctx context.Context, registration ClientRegistration) error {
+	_, err := sendRegistrationRequest(ctx, http.MethodDelete, registration.RegistrationClientURI, registration.RegistrationAccessToken, nil, http.StatusNoContent)
+	return err
+}
+
+// sendRegistrationRequest sends a request to a registration endpoint and decodes the client
+// registration of the response.
+func sendRegistrationRequest(ctx context.Context, method, endpoint, accessToken string, body any, wantStatus int) (*ClientRegistration, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("%w: no registration endpoint", ErrInvalidConfig)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to encode client metadata", ErrInternal)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create HTTP request", ErrInternal)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHTTPFailure, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		var errorResponse registrationErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errorResponse) == nil && errorResponse.Error != "" {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidResponse, errorResponse.Error, errorResponse.ErrorDescription)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResponse, resp.Status)
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	var registration ClientRegistration
+	if err := json.NewDecoder(resp.Body).Decode(&registration); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode client registration", ErrInvalidResponse)
+	}
+
+	if registration.ClientID == "" {
+		return nil, fmt.Errorf("%w: client registration without client_id", ErrInvalidResponse)
+	}
+
+	return &registration, nil
+}
+
+// NewRegisterCommand creates a command that registers the CLI as a native public client with
+// dynamic client registration (RFC 7591) and manages the registration (RFC 7592). The client ID
+// and the registration credentials are stored in the profile of the configuration file set with
+// WithConfigFile.
+func NewRegisterCommand(options ...Option) *cobra.Command {
+	var (
+		clientName         string
+		initialAccessToken string
+	)
+
+	cmd := &cobra.Command{
+		Use:         "register",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Register the CLI as a client with your OAuth2 provider.",
+		Long: `The "register" command registers the CLI as a native public client at the dynamic
+client registration endpoint of your OAuth2 provider, for providers where no client ID is
+provisioned in advance. The client ID and the credentials to manage the registration are
+stored in the profile of the configuration file.
+
+Use "register show", "register update" and "register delete" to manage the registration.
+`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, err := registrationConfig(cmd.Context(), options)
+			if err != nil {
+				return commandError("failed to configure auth", err)
+			}
+
+			if authConfig.RegistrationClientURI != "" {
+				return commandError("failed to register client", fmt.Errorf("%w: the profile is already registered as client %s, use register update or register delete", ErrInvalidConfig, authConfig.ClientId))
+			}
+
+			if authConfig.RegistrationEndpoint == "" {
+				if err := authConfig.discover(cmd.Context()); err != nil {
+					return commandError("failed to register client", err)
+				}
+			}
+
+			if authConfig.RegistrationEndpoint == "" {
+				return commandError("failed to register client", fmt.Errorf("%w: the provider has no registration endpoint", ErrInvalidConfig))
+			}
+
+			metadata, err := NativeClientMetadata(*authConfig, registrationClientName(cmd, clientName))
+			if err != nil {
+				return commandError("failed to register client", err)
+			}
+
+			registration, err := RegisterClient(cmd.Context(), authConfig.RegistrationEndpoint, *metadata, initialAccessToken)
+			if err != nil {
+				return commandError("failed to register client", err)
+			}
+
+			if err := saveRegistration(*authConfig, registration); err != nil {
+				return commandError("failed to store client registration", err)
+			}
+
+			cmd.Println("Registered client", registration.ClientID)
+
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&clientName, "client-name", "", "name of the client shown by the provider (default: the name of the CLI)")
+	cmd.Flags().StringVar(&initialAccessToken, "initial-access-token", "", "initial access token required by the provider to register clients")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:          "show",
+			Short:        "Print the registration of the client.",
+			Args:         cobra.NoArgs,
+			SilenceUsage: true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				authConfig, err := registeredConfig(cmd.Context(), options)
+				if err != nil {
+					return commandError("failed to configure auth", err)
+				}
+
+				registration, err := ReadClient(cmd.Context(), clientRegistration(*authConfig))
+				if err != nil {
+					return commandError("failed to read client registration", err)
+				}
+
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(registration.ClientMetadata)
+			},
+		},
+		&cobra.Command{
+			Use:          "update",
+			Short:        "Update the registration of the client with the current configuration.",
+			Args:         cobra.NoArgs,
+			SilenceUsage: true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				authConfig, err := registeredConfig(cmd.Context(), options)
+				if err != nil {
+					return commandError("failed to configure auth", err)
+				}
+
+				metadata, err := NativeClientMetadata(*authConfig, registrationClientName(cmd, clientName))
+				if err != nil {
+					return commandError("failed to update client registration", err)
+				}
+
+				registration, err := UpdateClient(cmd.Context(), clientRegistration(*authConfig), *metadata)
+				if err != nil {
+					return commandError("failed to update client registration", err)
+				}
+
+				if err := saveRegistration(*authConfig, registration); err != nil {
+					return commandError("failed to store client registration", err)
+				}
+
+				cmd.Println("Updated client", registration.ClientID)
+
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:          "delete",
+			Short:        "Delete the registration of the client.",
+			Args:         cobra.NoArgs,
+			SilenceUsage: true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				authConfig, err := registeredConfig(cmd.Context(), options)
+				if err != nil {
+					return commandError("failed to configure auth", err)
+				}
+
+				if err := DeleteClient(cmd.Context(), clientRegistration(*authConfig)); err != nil {
+					return commandError("failed to delete client registration", err)
+				}
+
+				if err := saveRegistration(*authConfig, nil); err != nil {
+					return commandError("failed to remove client registration", err)
+				}
+
+				cmd.Println("Deleted client", authConfig.ClientId)
+
+				return nil
+			},
+		},
+	)
+
+	return cmd
+}
+
+// registrationConfig builds the configuration for the register command. It is not validated,
+// since the client ID is only known after the registration.
+func registrationConfig(ctx context.Context, options []Option) (*Config, error) {
+	authConfig, err := resolveConfig(ctx, options, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if authConfig.ConfigFile == "" {
+		return nil, fmt.Errorf("%w: a configuration file is required to store the client registration", ErrInvalidConfig)
+	}
+
+	return authConfig, nil
+}
+
+// registeredConfig builds the configuration of a profile with a client registration.
+func registeredConfig(ctx context.Context, options []Option) (*Config, error) {
+	authConfig, err := registrationConfig(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if authConfig.RegistrationClientURI == "" || authConfig.RegistrationAccessToken == "" {
+		return nil, fmt.Errorf("%w: the profile has no client registration, run the register command first", ErrInvalidConfig)
+	}
+
+	return authConfig, nil
+}
+
+func clientRegistration(config Config) ClientRegistration {
+	return ClientRegistration{
+		ClientID:                config.ClientId,
+		RegistrationAccessToken: config.RegistrationAccessToken,
+		RegistrationClientURI:   config.RegistrationClientURI,
+	}
+}
+
+func registrationClientName(cmd *cobra.Command, clientName string) string {
+	if clientName != "" {
+		return clientName
+	}
+	return cmd.Root().Name()
+}
+
+// registrationSecrets are the credentials of a client registration. They are kept in the storage
+// provider instead of the configuration file.
+type registrationSecrets struct {
+	ClientSecret            string `json:"client_secret,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+}
+
+// registrationStorage returns the storage of the registration secrets of the profile, next to
+// the tokens of the profile.
+func registrationStorage(provider storage.StorageProvider, profile string) (storage.StorageProvider, error) {
+	keyed, ok := provider.(storage.KeyedStorageProvider)
+	if !ok {
+		return nil, fmt.Errorf("%w: the storage provider cannot hold the client registration of profile %s", ErrInvalidConfig, profile)
+	}
+	return storage.NewPrefixedStorage(keyed, profileStorageKeyPrefix+profile).WithKey(registrationStorageKey), nil
+}
+
+// loadRegistrationSecrets sets the client secret and the registration access token of the client
+// registered for the profile of the configuration file.
+func (c *Config) loadRegistrationSecrets() error {
+	if c.RegistrationClientURI == "" || c.storageProfile == "" {
+		return nil
+	}
+
+	provider, err := registrationStorage(c.StorageProvider, c.storageProfile)
+	if err != nil {
+		return err
+	}
+
+	raw, err := provider.GetToken()
+	if errors.Is(err, storage.ErrTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var secrets registrationSecrets
+	if err := json.Unmarshal([]byte(raw), &secrets); err != nil {
+		return errors.Join(storage.ErrInvalidToken, err)
+	}
+
+	c.ClientSecret = cmp.Or(secrets.ClientSecret, c.ClientSecret)
+	c.RegistrationAccessToken = cmp.Or(secrets.RegistrationAccessToken, c.RegistrationAccessToken)
+
+	// Flags and environment variables take precedence over the stored secrets as well
+	c.applyOverrides()
+	return nil
+}
+
+// saveRegistration stores the client ID and the client configuration endpoint in the profile of
+// the configuration file and the secrets of the registration in the storage provider, or removes
+// them if registration is nil. Secrets written to the file by earlier versions are removed.
+func saveRegistration(config Config, registration *ClientRegistration) error {
+	file, err := LoadConfigFile(config.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{
+		"client_id":                 "",
+		"client_secret":             "",
+		"registration_access_token": "",
+		"registration_client_uri":   "",
+	}
+	var secrets *registrationSecrets
+	if registration != nil {
+		values["client_id"] = registration.ClientID
+		values["registration_client_uri"] = cmp.Or(registration.RegistrationClientURI, config.RegistrationClientURI)
+		secrets = &registrationSecrets{
+			ClientSecret: registration.ClientSecret,
+			// Updates only return the registration credentials if they changed
+			RegistrationAccessToken: cmp.Or(registration.RegistrationAccessToken, config.RegistrationAccessToken),
+		}
+
+		// The storage backend of a profile is named after the client
+		config.ClientId = registration.ClientID
+		if err := config.applyStorageBackend(); err != nil {
+			return err
+		}
+	}
+
+	provider, err := registrationStorage(config.StorageProvider, file.profileName(config.Profile))
+	if err != nil {
+		return err
+	}
+
+	if secrets != nil {
+		raw, err := json.Marshal(secrets)
+		if err != nil {
+			return fmt.Errorf("%w: failed to encode client registration", ErrInternal)
+		}
+		if err := provider.SetToken(jwt.Token{Raw: string(raw)}); err != nil {
+			return err
+		}
+	} else if err := provider.DeleteToken(); err != nil && !errors.Is(err, storage.ErrTokenNotFound) {
+		return err
+	}
+
+	for key, value := range values {
+		if err := file.Set(config.Profile, key, value); err != nil {
+			return err
+		}
+	}
+
+	return file.Save(config.ConfigFile)
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNativeClientMetadata(t *testing.T) {
+	metadata, err := NativeClientMetadata(Config{GrantType: AuthorizationCode, Scopes: []string{"openid", "offline_access"}}, "mycli")
+	require.NoError(t, err)
+	assert.Equal(t, &ClientMetadata{
+		ClientName:              "mycli",
+		ApplicationType:         "native",
+		RedirectURIs:            []string{DefaultRedirectURI},
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		ResponseTypes:           []string{"code"},
+		TokenEndpointAuthMethod: "none",
+		Scope:                   "openid offline_access",
+	}, metadata)
+
+	metadata, err = NativeClientMetadata(Config{GrantType: DeviceCode, Scopes: []string{"openid"}}, "mycli")
+	require.NoError(t, err)
+	assert.Equal(t, []string{DeviceCode.String(), "refresh_token"}, metadata.GrantTypes)
+	assert.Empty(t, metadata.RedirectURIs)
+
+	_, err = NativeClientMetadata(Config{GrantType: ClientCredentials}, "mycli")
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestRegisterClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error": "invalid_redirect_uri", "error_description": "loopback redirect URIs are not allowed"}`))
+	}))
+	defer server.Close()
+
+	_, err := RegisterClient(context.Background(), server.URL, ClientMetadata{}, "")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+	assert.ErrorContains(t, err, "invalid_redirect_uri: loopback redirect URIs are not allowed")
+}
+
+func TestRegisterCommand(t *testing.T) {
+	var (
+		server     *httptest.Server
+		registered ClientMetadata
+		deleted    bool
+	)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/register":
+			assert.Equal(t, "Bearer initial_token", r.Header.Get("Authorization"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&registered))
+			w.WriteHeader(http.StatusCreated)
+			assert.NoError(t, json.NewEncoder(w).Encode(ClientRegistration{
+				ClientMetadata:          registered,
+				ClientID:                "registered_client",
+				ClientSecret:            "client_secret",
+				RegistrationAccessToken: "registration_token",
+				RegistrationClientURI:   server.URL + "/clients/registered_client",
+			}))
+		case r.URL.Path == "/clients/registered_client":
+			switch r.Method {
+			case http.MethodGet:
+				assert.Equal(t, "Bearer registration_token", r.Header.Get("Authorization"))
+				assert.NoError(t, json.NewEncoder(w).Encode(ClientRegistration{ClientMetadata: registered, ClientID: "registered_client"}))
+			case http.MethodPut:
+				assert.Equal(t, "Bearer registration_token", r.Header.Get("Authorization"))
+				var body map[string]any
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				assert.Equal(t, "registered_client", body["client_id"])
+				assert.Equal(t, "renamed", body["client_name"])
+				assert.NoError(t, json.NewEncoder(w).Encode(ClientRegistration{
+					ClientID:                "registered_client",
+					RegistrationAccessToken: "rotated_token",
+				}))
+			case http.MethodDelete:
+				assert.Equal(t, "Bearer rotated_token", r.Header.Get("Authorization"))
+				deleted = true
+				w.WriteHeader(http.StatusNoContent)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	provider := storage.NewMemoryStorage("test").(storage.KeyedStorageProvider)
+	options := []Option{
+		WithDeviceAuthorizationEndpoint(server.URL + "/device"),
+		WithTokenEndpoint(server.URL + "/token"),
+		WithRegistrationEndpoint(server.URL + "/register"),
+		WithStorageProvider(provider),
+		WithConfigFile(path),
+	}
+
+	run := func(args ...string) (string, error) {
+		cmd := NewRegisterCommand(options...)
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&out)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	_, err := run("show")
+	assert.Equal(t, ExitCodeConfig, ExitCode(err))
+
+	out, err := run("--initial-access-token", "initial_token")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Registered client registered_client")
+	assert.Equal(t, "register", registered.ClientName)
+	assert.Equal(t, "none", registered.TokenEndpointAuthMethod)
+
+	config, err := configure(options...)
+	require.NoError(t, err)
+	assert.Equal(t, "registered_client", config.ClientId)
+	assert.Equal(t, "client_secret", config.ClientSecret)
+	assert.Equal(t, "registration_token", config.RegistrationAccessToken)
+	assert.Equal(t, server.URL+"/clients/registered_client", config.RegistrationClientURI)
+
+	// The secrets are kept in the storage provider, not in the configuration file
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "client_secret")
+	assert.NotContains(t, string(content), "registration_token")
+	keys, err := provider.Keys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"profile:default/registration"}, keys)
+
+	_, err = run()
+	assert.ErrorIs(t, err, ErrInvalidConfig, "registering twice")
+
+	out, err = run("show")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"application_type": "native"`)
+
+	_, err = run("update", "--client-name", "renamed")
+	require.NoError(t, err)
+
+	config, err = configure(options...)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated_token", config.RegistrationAccessToken)
+	assert.Equal(t, server.URL+"/clients/registered_client", config.RegistrationClientURI)
+
+	_, err = run("delete")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	file, err := LoadConfigFile(path)
+	require.NoError(t, err)
+	_, ok := file.Get("", "client_id")
+	assert.False(t, ok)
+	keys, err = provider.Keys()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ErrURLNotAllowed is returned when a request would send the access token to a URL that is not
+// allowed by the configuration.
+var ErrURLNotAllowed = errors.New("url is not allowed")
+
+// apiRequest is a request sent by the request command.
+type apiRequest struct {
+	method  string
+	url     string
+	header  http.Header
+	body    []byte
+	include bool
+	raw     bool
+}
+
+// NewRequestCommand creates a command that sends an authenticated HTTP request, similar to
+// curl. The access token is only sent to the URLs configured with WithAllowedURLs, and the
+// request is retried once with a refreshed token if it is rejected with 401 Unauthorized.
+func NewRequestCommand(options ...Option) *cobra.Command {
+	var (
+		headers  []string
+		data     string
+		resource string
+		include  bool
+		raw      bool
+		timeout  time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:         "request METHOD URL",
+		Annotations: skipAuthAnnotations(),
+		Short:       "Send an authenticated HTTP request.",
+		Long: `The "request" command sends an HTTP request with your access token, so that you do not
+have to copy the token into curl. For example:
+
+  mycli request GET https://api.example.com/v1/users
+  mycli request POST https://api.example.com/v1/users -H "Content-Type: application/json" -d @user.json
+
+The body is read from a file with -d @file, or from stdin with -d @-. JSON responses are
+pretty-printed unless --raw is set. The token is only sent to the configured base URLs.
+The command exits with an error if the response status is 400 or above: with exit code 6 for
+401 and 403, 7 for server errors and 1 otherwise.
+`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, err := configureContext(cmd.Context(), options...)
+			if err != nil {
+				return commandError("failed to configure auth", err)
+			}
+
+			request := apiRequest{
+				method:  strings.ToUpper(args[0]),
+				url:     args[1],
+				header:  http.Header{},
+				include: include,
+				raw:     raw,
+			}
+
+			for _, header := range headers {
+				name, value, ok := strings.Cut(header, ":")
+				if !ok {
+					return commandError("invalid header", fmt.Errorf("%w: %q is not in the form NAME: VALUE", ErrInvalidConfig, header))
+				}
+				request.header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+			}
+
+			request.body, err = readRequestData(data, cmd.InOrStdin())
+			if err != nil {
+				return commandError("failed to read request body", err)
+			}
+
+			if _, err := ensureToken(cmd, *authConfig, resource, data != "@-" && isTerminal(os.Stdin)); err != nil {
+				return commandError("failed to fetch token", err)
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+
+			status, err := sendRequest(ctx, newTokenManager(*authConfig, resource), authConfig.AllowedURLs, request, cmd.OutOrStdout())
+			if err != nil {
+				return commandError("failed to send request", err)
+			}
+			if status >= http.StatusBadRequest {
+				return statusError(status)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&headers, "header", "H", nil, `request header, e.g. "Accept: application/json"`)
+	cmd.Flags().StringVarP(&data, "data", "d", "", "request body, @file to read it from a file or @- to read it from stdin")
+	cmd.Flags().StringVar(&resource, "resource", "", "send a token restricted to the given resource indicator (RFC 8707)")
+	cmd.Flags().BoolVarP(&include, "include", "i", false, "print the response status and headers")
+	cmd.Flags().BoolVar(&raw, "raw", false, "do not pretty-print JSON responses")
+	cmd.Flags().DurationVar(&timeout, "timeout", DefaultTimeout, "timeout of the request")
+
+	return cmd
+}
+
+// readRequestData returns the request body given by the data flag.
+func readRequestData(data string, stdin io.Reader) ([]byte, error) {
+	switch {
+	case data == "@-":
+		return io.ReadAll(stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(strings.TrimPrefix(data, "@"))
+	case data == "":
+		return nil, nil
+	default:
+		return []byte(data), nil
+	}
+}
+
+// sendRequest sends the request with the managed token and writes the response to out. If the
+// token is rejected, the request is retried once with a refreshed token. Redirects are only
+// followed to allowed URLs. It returns the status code of the response.
+func sendRequest(ctx context.Context, manager *TokenManager, allowed []string, request apiRequest, out io.Writer) (int, error) {
+	target, err := url.Parse(request.url)
+	if err != nil {
+		return 0, err
+	}
+	if !isAllowedURL(allowed, target) {
+		return 0, fmt.Errorf("%w: %s", ErrURLNotAllowed, request.url)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !isAllowedURL(allowed, req.URL) {
+				return fmt.Errorf("%w: redirect to %s", ErrURLNotAllowed, req.URL)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+
+	tokenSet, err := manager.Token(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := doAPIRequest(ctx, client, request, *tokenSet)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		if refreshed, err := manager.Refresh(ctx, tokenSet.AccessToken); err == nil && refreshed.AccessToken != tokenSet.AccessToken {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			resp, err = doAPIRequest(ctx, client, request, *refreshed)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	defer resp.Body.Close()
+
+	if err := writeResponse(out, resp, request.include, request.raw); err != nil {
+		return 0, err
+	}
+
+	return resp.StatusCode, nil
+}
+
+// doAPIRequest sends the request authorized with the token set.
+func doAPIRequest(ctx context.Context, client *http.Client, request apiRequest, tokenSet TokenSet) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, request.method, request.url, bytes.NewReader(request.body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = request.header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("Authorization", tokenSet.Type()+" "+tokenSet.AccessToken)
+
+	return client.Do(req)
+}
+
+// statusError returns the error of the request command for a failed response status. Rejected
+// tokens map to ExitCodeDenied and server errors to ExitCodeNetwork.
+func statusError(status int) error {
+	code := ExitCodeError
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		code = ExitCodeDenied
+	case status >= http.StatusInternalServerError:
+		code = ExitCodeNetwork
+	}
+
+	return &Error{
+		Code: code,
+		Err:  fmt.Errorf("request failed with status %d %s", status, http.StatusText(status)),
+	}
+}
+
+// writeResponse writes the response body to out, preceded by the status line and the headers
+// if include is set. JSON bodies are indented unless raw is set.
+func writeResponse(out io.Writer, resp *http.Response, include, raw bool) error {
+	if include {
+		fmt.Fprintf(out, "%s %s\n", resp.Proto, resp.Status)
+
+		names := make([]string, 0, len(resp.Header))
+		for name := range resp.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, value := range resp.Header[name] {
+				fmt.Fprintf(out, "%s: %s\n", name, value)
+			}
+		}
+		fmt.Fprintln(out)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if !raw && isJSONContentType(resp.Header.Get("Content-Type")) {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err == nil {
+			indented.WriteByte('\n')
+			body = indented.Bytes()
+		}
+	}
+
+	_, err = out.Write(body)
+	return err
+}
+
+// isJSONContentType reports whether the media type is application/json or a +json suffix type.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// isAllowedURL reports whether the target has the scheme and host of an allowed base URL and
+// its path is below the path of that base URL.
+func isAllowedURL(allowed []string, target *url.URL) bool {
+	for _, base := range allowed {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			continue
+		}
+
+		if !strings.EqualFold(baseURL.Scheme, target.Scheme) || !strings.EqualFold(baseURL.Host, target.Host) {
+			continue
+		}
+
+		// Dot segments must not escape the base path
+		targetPath := path.Clean("/" + target.Path)
+		basePath := strings.TrimSuffix(baseURL.Path, "/")
+		if targetPath == basePath || strings.HasPrefix(targetPath, basePath+"/") {
+			return true
+		}
+	}
+	return false
+}
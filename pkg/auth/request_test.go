@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAllowedURL(t *testing.T) {
+	allowed := []string{"https://api.example.com/v1", "https://other.example.com"}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://api.example.com/v1", want: true},
+		{url: "https://api.example.com/v1/users?limit=1", want: true},
+		{url: "https://API.example.com/v1/users", want: true},
+		{url: "https://other.example.com/anything", want: true},
+		{url: "https://api.example.com/v2/users"},
+		{url: "https://api.example.com/v1beta/users"},
+		{url: "https://api.example.com/v1/../admin"},
+		{url: "http://api.example.com/v1/users"},
+		{url: "https://api.example.com:8443/v1/users"},
+		{url: "https://evil.example.com/v1/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			target, err := url.Parse(tt.url)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, isAllowedURL(allowed, target))
+		})
+	}
+}
+
+func TestSendRequest(t *testing.T) {
+	tokenSet := TokenSet{AccessToken: "access_token", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+
+	t.Run("sends token and pretty-prints JSON", func(t *testing.T) {
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "Bearer access_token", r.Header.Get("Authorization"))
+			assert.Equal(t, "value", r.Header.Get("X-Custom"))
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":1}`))
+		}))
+		defer api.Close()
+
+		var out bytes.Buffer
+		status, err := sendRequest(context.Background(), newTestTokenManager(t, "https://example.com/token", tokenSet), []string{api.URL}, apiRequest{
+			method: http.MethodPost,
+			url:    api.URL + "/users",
+			header: http.Header{"X-Custom": []string{"value"}},
+			body:   []byte(`{"name":"test"}`),
+		}, &out)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "{\n  \"id\": 1\n}\n", out.String())
+	})
+
+	t.Run("refreshes token on 401", func(t *testing.T) {
+		var refreshes atomic.Int32
+		tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+		defer tokenServer.Close()
+
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body := make([]byte, 4)
+			n, _ := r.Body.Read(body)
+			assert.Equal(t, "body", string(body[:n]))
+
+			if r.Header.Get("Authorization") != "Bearer refreshed" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer api.Close()
+
+		var out bytes.Buffer
+		status, err := sendRequest(context.Background(), newTestTokenManager(t, tokenServer.URL, tokenSet), []string{api.URL}, apiRequest{
+			method: http.MethodPut,
+			url:    api.URL,
+			body:   []byte("body"),
+		}, &out)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "ok", out.String())
+		assert.Equal(t, int32(1), refreshes.Load())
+	})
+
+	t.Run("rejects URLs that are not allowed", func(t *testing.T) {
+		_, err := sendRequest(context.Background(), newTestTokenManager(t, "https://example.com/token", tokenSet), []string{"https://api.example.com"}, apiRequest{
+			method: http.MethodGet,
+			url:    "https://evil.example.com",
+		}, &bytes.Buffer{})
+		assert.ErrorIs(t, err, ErrURLNotAllowed)
+	})
+
+	t.Run("does not follow redirects to URLs that are not allowed", func(t *testing.T) {
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("token was sent to a URL that is not allowed")
+		}))
+		defer other.Close()
+
+		api := httptest.NewServer(http.RedirectHandler(other.URL, http.StatusFound))
+		defer api.Close()
+
+		_, err := sendRequest(context.Background(), newTestTokenManager(t, "https://example.com/token", tokenSet), []string{api.URL}, apiRequest{
+			method: http.MethodGet,
+			url:    api.URL,
+		}, &bytes.Buffer{})
+		assert.ErrorIs(t, err, ErrURLNotAllowed)
+	})
+
+	t.Run("includes status and headers", func(t *testing.T) {
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("missing"))
+		}))
+		defer api.Close()
+
+		var out bytes.Buffer
+		status, err := sendRequest(context.Background(), newTestTokenManager(t, "https://example.com/token", tokenSet), []string{api.URL}, apiRequest{
+			method:  http.MethodGet,
+			url:     api.URL,
+			include: true,
+		}, &out)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, status)
+		assert.Contains(t, out.String(), "HTTP/1.1 404 Not Found\n")
+		assert.Contains(t, out.String(), "Content-Type: text/plain\n")
+		assert.Contains(t, out.String(), "\n\nmissing")
+	})
+}
+
+func TestRequestCommandInvalidHeader(t *testing.T) {
+	cmd := NewRequestCommand(
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(storage.NewMemoryStorage("test")),
+		WithAllowedURLs([]string{"https://api.example.com"}),
+	)
+	cmd.SetArgs([]string{"GET", "https://api.example.com/users", "-H", "X-Custom"})
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+
+	err := cmd.Execute()
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.Equal(t, ExitCodeConfig, ExitCode(err))
+}
+
+func TestRequestCommandFailedStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		code   int
+	}{
+		{status: http.StatusUnauthorized, code: ExitCodeDenied},
+		{status: http.StatusForbidden, code: ExitCodeDenied},
+		{status: http.StatusNotFound, code: ExitCodeError},
+		{status: http.StatusServiceUnavailable, code: ExitCodeNetwork},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer api.Close()
+
+			cmd := NewRequestCommand(
+				WithClientID("client_id"),
+				WithDeviceAuthorizationEndpoint("https://example.com/device"),
+				WithTokenEndpoint("https://example.com/token"),
+				WithStorageProvider(newTestStorage(t, TokenSet{AccessToken: "access_token", Expiry: time.Now().Add(time.Hour)})),
+				WithAllowedURLs([]string{api.URL}),
+			)
+			cmd.SetArgs([]string{"GET", api.URL})
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetErr(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			assert.ErrorContains(t, err, "request failed with status "+strconv.Itoa(tt.status))
+			assert.Equal(t, tt.code, ExitCode(err))
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// AnnotationSkipAuth is the cobra.Command annotation that exempts a command and its
+// subcommands from RequireAuth. It is set on the commands of this package, which handle
+// authentication themselves.
+const AnnotationSkipAuth = "cobra-oauth2/skip-auth"
+
+// tokenContextKey is the context key of the token set stored by RequireAuth.
+type tokenContextKey struct{}
+
+// RequireAuth makes cmd and its subcommands require a valid login token. Before a command runs,
+// the token is refreshed if needed. If the user has to log in, the login flow is run when stdin
+// is a terminal or the grant needs no user, e.g. client credentials, and the command fails with
+// ExitCodeNotLoggedIn otherwise. The token set is
+// stored in the context of the command, see TokenFromContext.
+//
+// RequireAuth wraps the PersistentPreRunE or PersistentPreRun of cmd. Cobra only runs the hook of
+// the nearest command that defines one, so subcommands with their own persistent pre-run hook
+// must call Authenticate themselves, unless cobra.EnableTraverseRunHooks is set.
+func RequireAuth(cmd *cobra.Command, options ...Option) {
+	preRunE := cmd.PersistentPreRunE
+	preRun := cmd.PersistentPreRun
+
+	cmd.PersistentPreRun = nil
+	cmd.PersistentPreRunE = func(c *cobra.Command, args []string) error {
+		if err := Authenticate(c, options...); err != nil {
+			return err
+		}
+
+		switch {
+		case preRunE != nil:
+			return preRunE(c, args)
+		case preRun != nil:
+			preRun(c, args)
+		}
+		return nil
+	}
+}
+
+// Authenticate ensures that a valid login token exists before cmd runs and stores it in the
+// context of cmd. Commands annotated with AnnotationSkipAuth, their subcommands, and the help and
+// completion commands are skipped.
+func Authenticate(cmd *cobra.Command, options ...Option) error {
+	if skipsAuth(cmd) {
+		return nil
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	authConfig, err := configureContext(ctx, options...)
+	if err != nil {
+		return commandError("failed to configure auth", err)
+	}
+
+	interactive := isTerminal(os.Stdin)
+	tokenSet, err := ensureScopedToken(cmd, *authConfig, requiredScopes(cmd), interactive)
+	if err != nil {
+		var commandErr *Error
+		if errors.As(err, &commandErr) {
+			return err
+		}
+		if !interactive && loginRequired(err) {
+			return commandError(fmt.Sprintf("not logged in, run %q first", loginCommandPath(cmd)), err)
+		}
+		return commandError("authentication failed", err)
+	}
+
+	cmd.SetContext(context.WithValue(ctx, tokenContextKey{}, tokenSet))
+
+	return nil
+}
+
+// ensureScopedToken returns the login token set if it was granted the required scopes, and the
+// separate token set for the scopes missing from the login otherwise. The separate token set
+// belongs to the session of the login, so it is ignored after a new login and deleted on logout.
+func ensureScopedToken(cmd *cobra.Command, authConfig Config, required []string, interactive bool) (*TokenSet, error) {
+	loginTokenSet, err := ensureToken(cmd, authConfig, "", interactive)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := missingScopes(required, grantedScopes(*loginTokenSet, authConfig.Scopes))
+	if len(missing) == 0 {
+		return loginTokenSet, nil
+	}
+
+	scoped, err := scopedConfig(authConfig, required, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSet, err := fetchToken(cmd.Context(), scoped, tokenRequest{minValid: DefaultExpiryDelta})
+	switch {
+	case err == nil && tokenSet.Session == loginTokenSet.Session:
+	case err != nil && !loginRequired(err):
+		return nil, err
+	case !interactive && scoped.GrantType.needsUser():
+		return nil, &Error{
+			Code: ExitCodeNotLoggedIn,
+			Err:  fmt.Errorf("no token for the scopes %s, run the command in a terminal to grant them", joinScopes(required)),
+		}
+	default:
+		accessToken, err := login(cmd, scoped)
+		if err != nil {
+			return nil, err
+		}
+
+		tokenSet = NewTokenSet(*accessToken, scoped.Resources)
+		tokenSet.Session = loginTokenSet.Session
+		if err := SaveTokenSet(scoped.StorageProvider, *tokenSet); err != nil {
+			return nil, fmt.Errorf("storing access token: %w", err)
+		}
+	}
+
+	if notGranted := missingScopes(missing, grantedScopes(*tokenSet, scoped.Scopes)); len(notGranted) > 0 {
+		return nil, fmt.Errorf("%w: %s not granted", ErrInvalidScope, joinScopes(notGranted))
+	}
+
+	return tokenSet, nil
+}
+
+// TokenFromContext returns the token set stored by RequireAuth or Authenticate.
+func TokenFromContext(ctx context.Context) (*TokenSet, bool) {
+	tokenSet, ok := ctx.Value(tokenContextKey{}).(*TokenSet)
+	return tokenSet, ok
+}
+
+// skipAuthAnnotations returns the annotations of the commands of this package.
+func skipAuthAnnotations() map[string]string {
+	return map[string]string{AnnotationSkipAuth: "true"}
+}
+
+// skipsAuth reports whether cmd is exempt from RequireAuth.
+func skipsAuth(cmd *cobra.Command) bool {
+	switch cmd.Name() {
+	case "help", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return true
+	}
+
+	for c := cmd; c != nil; c = c.Parent() {
+		if _, ok := c.Annotations[AnnotationSkipAuth]; ok {
+			return true
+		}
+		if c.Name() == "completion" && c.Parent() == cmd.Root() {
+			return true
+		}
+	}
+	return false
+}
+
+// loginCommandPath returns the command path of the login command in the command tree of cmd.
+func loginCommandPath(cmd *cobra.Command) string {
+	var find func(c *cobra.Command) string
+	find = func(c *cobra.Command) string {
+		for _, child := range c.Commands() {
+			if child.Name() == "login" && child.Annotations[AnnotationSkipAuth] != "" {
+				return child.CommandPath()
+			}
+			if path := find(child); path != "" {
+				return path
+			}
+		}
+		return ""
+	}
+
+	if path := find(cmd.Root()); path != "" {
+		return path
+	}
+	return cmd.Root().Name() + " login"
+}
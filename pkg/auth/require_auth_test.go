@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequireAuthTestCommand(provider storage.StorageProvider, ran *string) *cobra.Command {
+	options := []Option{
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(provider),
+	}
+
+	root := &cobra.Command{
+		Use: "mycli",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			*ran += "pre-run,"
+		},
+	}
+	RequireAuth(root, options...)
+
+	authCmd := &cobra.Command{Use: "auth"}
+	authCmd.AddCommand(NewLoginCommand(options...), NewLogoutCommand(options...))
+
+	root.AddCommand(
+		authCmd,
+		&cobra.Command{
+			Use: "api",
+			Run: func(cmd *cobra.Command, args []string) {
+				tokenSet, ok := TokenFromContext(cmd.Context())
+				if ok {
+					*ran += "api:" + tokenSet.AccessToken
+				}
+			},
+		},
+	)
+
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	return root
+}
+
+func TestRequireAuth(t *testing.T) {
+	t.Run("stores the token in the context", func(t *testing.T) {
+		provider := newTestStorage(t, TokenSet{AccessToken: "access_token", Expiry: time.Now().Add(time.Hour)})
+
+		var ran string
+		root := newRequireAuthTestCommand(provider, &ran)
+		root.SetArgs([]string{"api"})
+		assert.NoError(t, root.Execute())
+		assert.Equal(t, "pre-run,api:access_token", ran)
+	})
+
+	t.Run("fails fast without a terminal", func(t *testing.T) {
+		var ran string
+		root := newRequireAuthTestCommand(storage.NewMemoryStorage("test"), &ran)
+		root.SetArgs([]string{"api"})
+
+		err := root.Execute()
+		assert.Equal(t, ExitCodeNotLoggedIn, ExitCode(err))
+		assert.Contains(t, err.Error(), `run "mycli auth login" first`)
+		assert.Empty(t, ran)
+	})
+
+	t.Run("skips commands of this package", func(t *testing.T) {
+		provider := newTestStorage(t, TokenSet{AccessToken: "access_token"})
+
+		var ran string
+		root := newRequireAuthTestCommand(provider, &ran)
+		root.SetArgs([]string{"auth", "logout"})
+		assert.NoError(t, root.Execute())
+		assert.Equal(t, "pre-run,", ran)
+
+		_, err := LoadTokenSet(provider)
+		assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+	})
+
+	t.Run("skips help", func(t *testing.T) {
+		var ran string
+		root := newRequireAuthTestCommand(storage.NewMemoryStorage("test"), &ran)
+		root.SetArgs([]string{"help", "api"})
+		assert.NoError(t, root.Execute())
+	})
+}
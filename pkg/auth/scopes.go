@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// AnnotationScopes is the cobra.Command annotation with the space-separated scopes that a command
+// and its subcommands require, see RequireScopes.
+const AnnotationScopes = "cobra-oauth2/scopes"
+
+// offlineAccessScope is the scope that requests a refresh token.
+const offlineAccessScope = "offline_access"
+
+// RequireScopes annotates cmd with scopes that it and its subcommands require in addition to
+// the login. Authenticate uses the login token if it was granted all required scopes. Otherwise
+// it uses a separate token for the scopes missing from the login, and asks the user to log in for
+// them if no such token is stored yet. The login token keeps its scopes, so that other commands do not run
+// with more privileges than they need.
+func RequireScopes(cmd *cobra.Command, scopes ...string) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+
+	required := append(strings.Fields(cmd.Annotations[AnnotationScopes]), scopes...)
+	cmd.Annotations[AnnotationScopes] = joinScopes(normalizeScopes(required))
+}
+
+// requiredScopes returns the scopes required by cmd and its parents.
+func requiredScopes(cmd *cobra.Command) []string {
+	var scopes []string
+	for c := cmd; c != nil; c = c.Parent() {
+		scopes = append(scopes, strings.Fields(c.Annotations[AnnotationScopes])...)
+	}
+	return normalizeScopes(scopes)
+}
+
+// grantedScopes returns the scopes of the token set. A token response without scope was granted
+// the requested scopes (RFC 6749, section 5.1).
+func grantedScopes(tokenSet TokenSet, requested []string) []string {
+	if tokenSet.Scope == "" {
+		return requested
+	}
+	return strings.Fields(tokenSet.Scope)
+}
+
+// missingScopes returns the scopes of required that are not in granted.
+func missingScopes(required, granted []string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// scopeKey returns the storage key of the token set for the given scopes.
+func scopeKey(scopes []string) string {
+	return "scopes:" + joinScopes(normalizeScopes(scopes))
+}
+
+// scopedConfig returns the configuration of the separate token for the required scopes, which is
+// stored under its own key. Only the scopes missing from the login are requested, so that the
+// user is asked for incremental consent, together with offline_access if the login requests it,
+// so that the separate token can be refreshed as well.
+func scopedConfig(config Config, required, missing []string) (Config, error) {
+	scopedStorage, ok := storageForKey(config.StorageProvider, scopeKey(required))
+	if !ok {
+		return Config{}, fmt.Errorf("%w: the storage provider cannot hold tokens for additional scopes", ErrInvalidConfig)
+	}
+
+	scopes := slices.Clone(missing)
+	if slices.Contains(config.Scopes, offlineAccessScope) {
+		scopes = append(scopes, offlineAccessScope)
+	}
+
+	scoped := config
+	scoped.StorageProvider = scopedStorage
+	scoped.Scopes = normalizeScopes(scopes)
+	return scoped, nil
+}
+
+// normalizeScopes returns the sorted scopes without duplicates.
+func normalizeScopes(scopes []string) []string {
+	normalized := slices.Clone(scopes)
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireScopes(t *testing.T) {
+	parent := &cobra.Command{Use: "admin"}
+	RequireScopes(parent, "admin")
+
+	child := &cobra.Command{Use: "users"}
+	RequireScopes(child, "users:write", "admin")
+	RequireScopes(child, "users:read")
+	parent.AddCommand(child)
+
+	assert.Equal(t, "admin users:read users:write", child.Annotations[AnnotationScopes])
+	assert.Equal(t, []string{"admin", "users:read", "users:write"}, requiredScopes(child))
+	assert.Equal(t, []string{"admin"}, requiredScopes(parent))
+}
+
+func TestEnsureScopedToken(t *testing.T) {
+	newConfig := func(tokenEndpoint string) Config {
+		return Config{
+			ClientId:        "client_id",
+			TokenEndpoint:   tokenEndpoint,
+			Scopes:          []string{"openid", "read"},
+			StorageProvider: storage.NewMemoryStorage("test"),
+			GrantType:       ClientCredentials,
+		}
+	}
+
+	newCommand := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.SetContext(context.Background())
+		cmd.SetOut(&bytes.Buffer{})
+		return cmd
+	}
+
+	t.Run("login token with required scopes", func(t *testing.T) {
+		config := newConfig("https://example.com/token")
+		_, err := SaveLoginTokenSet(config, AccessTokenResponse{AccessToken: "login_token", ExpiresIn: 3600, Scope: "openid read"})
+		assert.NoError(t, err)
+
+		tokenSet, err := ensureScopedToken(newCommand(), config, []string{"read"}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "login_token", tokenSet.AccessToken)
+	})
+
+	t.Run("incremental login for missing scopes", func(t *testing.T) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "admin offline_access", r.PostForm.Get("scope"))
+			assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "admin_token",
+				"expires_in":   3600,
+				"scope":        "admin offline_access",
+			}))
+		}))
+		defer server.Close()
+
+		config := newConfig(server.URL)
+		config.Scopes = append(config.Scopes, "offline_access")
+		loginTokenSet, err := SaveLoginTokenSet(config, AccessTokenResponse{AccessToken: "login_token", ExpiresIn: 3600})
+		assert.NoError(t, err)
+
+		// Client credentials need no terminal to get the missing scopes
+		tokenSet, err := ensureScopedToken(newCommand(), config, []string{"read", "admin"}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "admin_token", tokenSet.AccessToken)
+		assert.Equal(t, int32(1), requests.Load())
+
+		// The separate token is stored for the session of the login, the login token is kept
+		scopedStorage, _ := storageForKey(config.StorageProvider, scopeKey([]string{"admin", "read"}))
+		stored, err := LoadTokenSet(scopedStorage)
+		assert.NoError(t, err)
+		assert.Equal(t, loginTokenSet.Session, stored.Session)
+
+		tokenSet, err = ensureScopedToken(newCommand(), config, []string{"admin", "read"}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "admin_token", tokenSet.AccessToken)
+		assert.Equal(t, int32(1), requests.Load())
+
+		tokenSet, err = ensureScopedToken(newCommand(), config, []string{"read"}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "login_token", tokenSet.AccessToken)
+
+		// A new login discards the separate token
+		_, err = SaveLoginTokenSet(config, AccessTokenResponse{AccessToken: "new_login_token", ExpiresIn: 3600})
+		assert.NoError(t, err)
+
+		_, err = ensureScopedToken(newCommand(), config, []string{"read", "admin"}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), requests.Load())
+
+		// Logout deletes the separate token
+		assert.NoError(t, deleteTokenSets(config))
+		_, err = LoadTokenSet(scopedStorage)
+		assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+	})
+
+	t.Run("user grants need a terminal", func(t *testing.T) {
+		config := newConfig("https://example.com/token")
+		config.GrantType = DeviceCode
+		_, err := SaveLoginTokenSet(config, AccessTokenResponse{AccessToken: "login_token", ExpiresIn: 3600})
+		assert.NoError(t, err)
+
+		_, err = ensureScopedToken(newCommand(), config, []string{"read", "admin"}, false)
+		assert.Equal(t, ExitCodeNotLoggedIn, ExitCode(err))
+	})
+
+	t.Run("scopes not granted", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "read_token",
+				"expires_in":   3600,
+				"scope":        "read",
+			}))
+		}))
+		defer server.Close()
+
+		config := newConfig(server.URL)
+		_, err := SaveLoginTokenSet(config, AccessTokenResponse{AccessToken: "login_token", ExpiresIn: 3600})
+		assert.NoError(t, err)
+
+		_, err = ensureScopedToken(newCommand(), config, []string{"admin"}, true)
+		assert.ErrorIs(t, err, ErrInvalidScope)
+		assert.Equal(t, ExitCodeDenied, ExitCode(err))
+	})
+}
+
+func TestGrantedScopes(t *testing.T) {
+	assert.Equal(t, []string{"openid"}, grantedScopes(TokenSet{}, []string{"openid"}))
+	assert.Equal(t, []string{"read", "write"}, grantedScopes(TokenSet{Scope: "read write", Expiry: time.Now()}, []string{"openid"}))
+}
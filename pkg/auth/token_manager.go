@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenRefreshRetryInterval is the delay before the background refresh is retried after a failure.
+const tokenRefreshRetryInterval = 30 * time.Second
+
+// TokenManager keeps the token set of a configuration in memory and refreshes it when needed.
+// Concurrent callers share a single refresh, and Run refreshes the token set in the background
+// ahead of its expiry. A TokenManager is safe for concurrent use.
+type TokenManager struct {
+	config   Config
+	resource string
+
+	mutex       sync.Mutex
+	tokenSet    *TokenSet
+	inflight    *tokenRefresh
+	subscribers map[int]func(TokenSet)
+	nextID      int
+}
+
+// tokenRefresh is a refresh in progress that concurrent callers wait for.
+type tokenRefresh struct {
+	rejected string
+	done     chan struct{}
+	tokenSet *TokenSet
+	err      error
+}
+
+// NewTokenManager creates a TokenManager for the login token set of the given configuration.
+func NewTokenManager(options ...Option) (*TokenManager, error) {
+	authConfig, err := configure(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTokenManager(*authConfig, ""), nil
+}
+
+// NewResourceTokenManager creates a TokenManager for the token set of the given resource
+// indicator (RFC 8707).
+func NewResourceTokenManager(resource string, options ...Option) (*TokenManager, error) {
+	authConfig, err := configure(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTokenManager(*authConfig, resource), nil
+}
+
+func newTokenManager(config Config, resource string) *TokenManager {
+	return &TokenManager{
+		config:      config,
+		resource:    resource,
+		subscribers: map[int]func(TokenSet){},
+	}
+}
+
+// Token returns the cached token set. It is refreshed first if it expires within DefaultExpiryDelta.
+func (m *TokenManager) Token(ctx context.Context) (*TokenSet, error) {
+	return m.token(ctx, "")
+}
+
+// Refresh replaces the given access token, e.g. after it was rejected by a resource server.
+// If the token was already replaced by a concurrent refresh, the new token set is returned.
+func (m *TokenManager) Refresh(ctx context.Context, rejected string) (*TokenSet, error) {
+	return m.token(ctx, rejected)
+}
+
+// Subscribe registers fn to be called with the new token set whenever it changes.
+// The returned function removes the subscription.
+func (m *TokenManager) Subscribe(fn func(TokenSet)) func() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	id := m.nextID
+	m.nextID++
+	m.subscribers[id] = fn
+
+	return func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		delete(m.subscribers, id)
+	}
+}
+
+// Reset drops the cached token set, so that the next call reads it from storage again.
+func (m *TokenManager) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.tokenSet = nil
+}
+
+// Transport returns an http.RoundTripper that authenticates requests with the managed token.
+// If base is nil, http.DefaultTransport is used.
+func (m *TokenManager) Transport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base, manager: m}
+}
+
+// TokenSource returns an oauth2.TokenSource that serves the managed token.
+func (m *TokenManager) TokenSource() *TokenSource {
+	return &TokenSource{manager: m}
+}
+
+// Run refreshes the token set in the background one to two minutes before it expires, with a
+// random jitter so that multiple processes do not refresh at the same time. Failed refreshes are
+// retried. Run blocks until ctx is done and returns its error.
+func (m *TokenManager) Run(ctx context.Context) error {
+	for {
+		wait := tokenRefreshRetryInterval
+		scheduled := ""
+
+		if tokenSet, err := m.Token(ctx); err == nil {
+			if tokenSet.Expiry.IsZero() {
+				// Token sets without expiry are only replaced on demand
+				<-ctx.Done()
+				return ctx.Err()
+			}
+
+			wait = refreshDelay(time.Until(tokenSet.Expiry))
+			scheduled = tokenSet.AccessToken
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if scheduled != "" {
+			// Errors surface in the next iteration, which retries after tokenRefreshRetryInterval
+			_, _ = m.Refresh(ctx, scheduled)
+		}
+	}
+}
+
+// refreshDelay returns the delay before a token with the given remaining lifetime is refreshed
+// in the background: one to two minutes before it expires, but not before half of its lifetime.
+func refreshDelay(remaining time.Duration) time.Duration {
+	lead := DefaultExpiryDelta + time.Duration(rand.Int64N(int64(DefaultExpiryDelta)))
+	if lead > remaining/2 {
+		lead = remaining / 2
+	}
+	return max(remaining-lead, time.Second)
+}
+
+// token returns the cached token set, or fetches it if it expires within DefaultExpiryDelta
+// or matches the rejected access token. Only one fetch is in progress at a time.
+func (m *TokenManager) token(ctx context.Context, rejected string) (*TokenSet, error) {
+	// Transports and token sources that were not created by a constructor have no manager
+	if m == nil {
+		return nil, fmt.Errorf("%w: not created with a constructor such as NewTransport or NewTokenSource", ErrInvalidConfig)
+	}
+
+	request := tokenRequest{
+		resource: m.resource,
+		minValid: DefaultExpiryDelta,
+		rejected: rejected,
+	}
+
+	m.mutex.Lock()
+	if m.tokenSet != nil && !request.needsRefresh(*m.tokenSet) {
+		tokenSet := m.tokenSet
+		m.mutex.Unlock()
+		return tokenSet, nil
+	}
+
+	refresh := m.inflight
+	if refresh == nil {
+		refresh = &tokenRefresh{rejected: rejected, done: make(chan struct{})}
+		m.inflight = refresh
+		go m.refresh(refresh, request)
+	}
+	m.mutex.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-refresh.done:
+	}
+
+	if refresh.err != nil {
+		return nil, refresh.err
+	}
+
+	// The refresh may have been started for a different rejected token
+	if rejected != "" && refresh.rejected != rejected && refresh.tokenSet.AccessToken == rejected {
+		return m.token(ctx, rejected)
+	}
+
+	return refresh.tokenSet, nil
+}
+
+// refresh fetches the token set and publishes the result to the waiting callers. It does not
+// use the context of a caller, so a cancelled caller does not fail the refresh for the others.
+func (m *TokenManager) refresh(refresh *tokenRefresh, request tokenRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	tokenSet, err := fetchToken(ctx, m.config, request)
+
+	m.mutex.Lock()
+	previous := m.tokenSet
+	if err == nil {
+		m.tokenSet = tokenSet
+	}
+	m.inflight = nil
+	subscribers := make([]func(TokenSet), 0, len(m.subscribers))
+	for _, fn := range m.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	m.mutex.Unlock()
+
+	refresh.tokenSet, refresh.err = tokenSet, err
+	close(refresh.done)
+
+	if err == nil && (previous == nil || previous.AccessToken != tokenSet.AccessToken) {
+		for _, fn := range subscribers {
+			fn(*tokenSet)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenManager_Token(t *testing.T) {
+	var refreshes atomic.Int32
+	tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+	defer tokenServer.Close()
+
+	manager := newTestTokenManager(t, tokenServer.URL, TokenSet{
+		AccessToken:  "expired",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(-time.Minute),
+	})
+
+	var notifications atomic.Int32
+	unsubscribe := manager.Subscribe(func(tokenSet TokenSet) {
+		notifications.Add(1)
+		assert.Equal(t, "refreshed", tokenSet.AccessToken)
+	})
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokenSet, err := manager.Token(context.Background())
+			if assert.NoError(t, err) {
+				assert.Equal(t, "refreshed", tokenSet.AccessToken)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), refreshes.Load())
+	assert.Equal(t, int32(1), notifications.Load())
+
+	// Cached token sets are served without reading storage
+	assert.NoError(t, manager.config.StorageProvider.DeleteToken())
+	tokenSet, err := manager.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "refreshed", tokenSet.AccessToken)
+}
+
+func TestTokenManager_Refresh(t *testing.T) {
+	var refreshes atomic.Int32
+	tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+	defer tokenServer.Close()
+
+	manager := newTestTokenManager(t, tokenServer.URL, TokenSet{
+		AccessToken:  "rejected",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(time.Hour),
+	})
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokenSet, err := manager.Refresh(context.Background(), "rejected")
+			if assert.NoError(t, err) {
+				assert.Equal(t, "refreshed", tokenSet.AccessToken)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), refreshes.Load())
+}
+
+func TestTokenManager_Run(t *testing.T) {
+	var refreshes atomic.Int32
+	tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+	defer tokenServer.Close()
+
+	manager := newTestTokenManager(t, tokenServer.URL, TokenSet{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(time.Second),
+	})
+
+	refreshed := make(chan TokenSet, 1)
+	manager.Subscribe(func(tokenSet TokenSet) {
+		refreshed <- tokenSet
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- manager.Run(ctx)
+	}()
+
+	select {
+	case tokenSet := <-refreshed:
+		assert.Equal(t, "refreshed", tokenSet.AccessToken)
+	case <-time.After(10 * time.Second):
+		t.Fatal("token was not refreshed in the background")
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, int32(1), refreshes.Load())
+}
+
+func TestRefreshDelay(t *testing.T) {
+	for range 100 {
+		delay := refreshDelay(time.Hour)
+		assert.GreaterOrEqual(t, delay, time.Hour-2*DefaultExpiryDelta)
+		assert.LessOrEqual(t, delay, time.Hour-DefaultExpiryDelta)
+	}
+
+	// Short-lived tokens are refreshed after half of their lifetime
+	assert.Equal(t, 30*time.Second, refreshDelay(time.Minute))
+
+	// The delay never drops to zero
+	assert.Equal(t, time.Second, refreshDelay(0))
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Output formats of the token command.
+const (
+	TokenOutputRaw    = "raw"
+	TokenOutputJSON   = "json"
+	TokenOutputHeader = "header"
+	TokenOutputEnv    = "env"
+	TokenOutputCurl   = "curl"
+)
+
+// ErrUnsupportedOutput is returned for an unknown output format of the token command.
+var ErrUnsupportedOutput = errors.New("unsupported output format")
+
+// tokenOutput is the JSON output of the token command. The refresh token is never printed.
+type tokenOutput struct {
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	ExpiresIn   int64      `json:"expires_in,omitempty"`
+	Scope       string     `json:"scope,omitempty"`
+}
+
+// writeToken writes the access token of the token set in the given output format.
+func writeToken(out io.Writer, tokenSet TokenSet, format string) error {
+	switch format {
+	case TokenOutputRaw, "":
+		_, err := fmt.Fprintln(out, tokenSet.AccessToken)
+		return err
+	case TokenOutputJSON:
+		output := tokenOutput{
+			AccessToken: tokenSet.AccessToken,
+			TokenType:   tokenSet.Type(),
+			Scope:       tokenSet.Scope,
+		}
+		if !tokenSet.Expiry.IsZero() {
+			expiry := tokenSet.Expiry.UTC()
+			output.ExpiresAt = &expiry
+			output.ExpiresIn = int64(time.Until(tokenSet.Expiry).Seconds())
+		}
+
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	case TokenOutputHeader:
+		_, err := fmt.Fprintf(out, "Authorization: %s %s\n", tokenSet.Type(), tokenSet.AccessToken)
+		return err
+	case TokenOutputEnv:
+		_, err := fmt.Fprintf(out, "export %s=%s\n", DefaultExecEnv, shellQuote(tokenSet.AccessToken))
+		return err
+	case TokenOutputCurl:
+		_, err := fmt.Fprintf(out, "header = \"Authorization: %s %s\"\n", tokenSet.Type(), tokenSet.AccessToken)
+		return err
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedOutput, format)
+	}
+}
+
+// writeDecodedToken writes the header and claims of a JWT without verifying its signature.
+func writeDecodedToken(out io.Writer, accessToken string) error {
+	token, _, err := new(jwt.Parser).ParseUnverified(accessToken, jwt.MapClaims{})
+	if err != nil {
+		return fmt.Errorf("access token is not a JWT: %w", err)
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]any{
+		"header": token.Header,
+		"claims": token.Claims,
+	})
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteToken(t *testing.T) {
+	tokenSet := TokenSet{AccessToken: "access'token", TokenType: "bearer"}
+
+	tests := []struct {
+		format  string
+		want    string
+		wantErr error
+	}{
+		{format: TokenOutputRaw, want: "access'token\n"},
+		{format: TokenOutputHeader, want: "Authorization: Bearer access'token\n"},
+		{format: TokenOutputEnv, want: "export ACCESS_TOKEN='access'\\''token'\n"},
+		{format: TokenOutputCurl, want: "header = \"Authorization: Bearer access'token\"\n"},
+		{format: TokenOutputJSON, want: "{\n  \"access_token\": \"access'token\",\n  \"token_type\": \"Bearer\"\n}\n"},
+		{format: "yaml", wantErr: ErrUnsupportedOutput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			err := writeToken(&out, tokenSet, tt.format)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestWriteDecodedToken(t *testing.T) {
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user"}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, writeDecodedToken(&out, accessToken))
+
+	var decoded struct {
+		Header map[string]any `json:"header"`
+		Claims map[string]any `json:"claims"`
+	}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, "HS256", decoded.Header["alg"])
+	assert.Equal(t, "user", decoded.Claims["sub"])
+
+	assert.Error(t, writeDecodedToken(&out, "opaque"))
+}
+
+func TestTokenCommandMinValid(t *testing.T) {
+	var refreshes atomic.Int32
+	tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+	defer tokenServer.Close()
+
+	provider := newTestStorage(t, TokenSet{
+		AccessToken:  "access_token",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(3 * time.Minute),
+	})
+
+	newCommand := func(args ...string) *bytes.Buffer {
+		cmd := NewTokenCommand(
+			WithClientID("client_id"),
+			WithDeviceAuthorizationEndpoint("https://example.com/device"),
+			WithTokenEndpoint(tokenServer.URL),
+			WithStorageProvider(provider),
+		)
+
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetArgs(args)
+		assert.NoError(t, cmd.Execute())
+		return &out
+	}
+
+	assert.Equal(t, "access_token\n", newCommand().String())
+	assert.Equal(t, int32(0), refreshes.Load())
+
+	assert.Equal(t, "Authorization: Bearer refreshed\n", newCommand("--min-valid", "5m", "--output", "header").String())
+	assert.Equal(t, int32(1), refreshes.Load())
+}
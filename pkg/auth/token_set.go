@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+)
+
+// TokenSet holds the tokens that are persisted in the storage provider after a successful login.
+type TokenSet struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	Resources    []string  `json:"resources,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+	// IDToken is the OpenID Connect ID token of the login, sent as id_token_hint on logout.
+	IDToken string `json:"id_token,omitempty"`
+	// Session identifies the login the token set originates from. Token sets derived from
+	// the login token set, such as downscoped tokens for a resource, share its session.
+	Session string `json:"session,omitempty"`
+}
+
+// NewTokenSet creates a token set from a token response.
+func NewTokenSet(response AccessTokenResponse, resources []string) *TokenSet {
+	tokenSet := &TokenSet{
+		AccessToken:  response.AccessToken,
+		TokenType:    response.TokenType,
+		RefreshToken: response.RefreshToken,
+		Scope:        response.Scope,
+		Resources:    resources,
+		IDToken:      response.IDToken,
+	}
+
+	if response.ExpiresIn > 0 {
+		tokenSet.Expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+
+	return tokenSet
+}
+
+// Type returns the token type for the Authorization header. The token type is compared case
+// insensitively (RFC 6749), so the common "bearer" is normalized to "Bearer".
+func (t TokenSet) Type() string {
+	if t.TokenType == "" || strings.EqualFold(t.TokenType, "bearer") {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+// Valid reports whether the token set has an access token that has not expired.
+func (t TokenSet) Valid() bool {
+	return t.AccessToken != "" && !t.ExpiresWithin(0)
+}
+
+// ExpiresWithin reports whether the access token expires within the given duration.
+// Token sets without a known expiry never expire.
+func (t TokenSet) ExpiresWithin(d time.Duration) bool {
+	if t.Expiry.IsZero() {
+		return false
+	}
+	return time.Now().Add(d).After(t.Expiry)
+}
+
+// LoadTokenSet reads the token set from the storage provider. Tokens stored by earlier
+// versions of this library, which only hold the raw access token, are returned as a token
+// set without expiry.
+func LoadTokenSet(provider storage.StorageProvider) (*TokenSet, error) {
+	raw, err := provider.GetToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(raw, "{") {
+		return &TokenSet{AccessToken: raw}, nil
+	}
+
+	var tokenSet TokenSet
+	if err := json.Unmarshal([]byte(raw), &tokenSet); err != nil {
+		return nil, errors.Join(storage.ErrInvalidToken, err)
+	}
+
+	return &tokenSet, nil
+}
+
+// SaveTokenSet writes the token set to the storage provider.
+func SaveTokenSet(provider storage.StorageProvider, tokenSet TokenSet) error {
+	raw, err := json.Marshal(tokenSet)
+	if err != nil {
+		return fmt.Errorf("%w: failed to encode token set", ErrInternal)
+	}
+
+	return provider.SetToken(jwt.Token{Raw: string(raw)})
+}
+
+// SaveLoginTokenSet stores the token response of a login as the login token set of a new session.
+func SaveLoginTokenSet(config Config, response AccessTokenResponse) (*TokenSet, error) {
+	session, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSet := NewTokenSet(response, config.Resources)
+	tokenSet.Session = session
+	if err := SaveTokenSet(config.StorageProvider, *tokenSet); err != nil {
+		return nil, err
+	}
+
+	return tokenSet, nil
+}
+
+// storageForKey returns the storage provider for the token stored under key. It reports false
+// if the provider does not implement storage.KeyedStorageProvider and can only hold a single token.
+func storageForKey(provider storage.StorageProvider, key string) (storage.StorageProvider, bool) {
+	if key == "" {
+		return provider, true
+	}
+
+	if keyed, ok := provider.(storage.KeyedStorageProvider); ok {
+		return keyed.WithKey(key), true
+	}
+
+	return nil, false
+}
+
+// resourceKey returns the storage key of the token set for the given resource.
+func resourceKey(resource string) string {
+	return "resource:" + resource
+}
+
+// isDerivedKey reports whether key is the storage key of a token set derived from the login
+// token set, i.e. the token set of a resource or of additional scopes.
+func isDerivedKey(key string) bool {
+	return strings.HasPrefix(key, resourceKey("")) || strings.HasPrefix(key, scopeKey(nil))
+}
+
+// deleteTokenSets deletes the login token set and all token sets derived from it, e.g. the
+// cached tokens of resources. Token sets that are not stored are skipped, so the derived token
+// sets are deleted even if the login token set is gone.
+func deleteTokenSets(config Config) error {
+	var keys []string
+	for _, resource := range config.Resources {
+		keys = append(keys, resourceKey(resource))
+	}
+
+	var errs []error
+	if keyed, ok := config.StorageProvider.(storage.KeyedStorageProvider); ok {
+		stored, err := keyed.Keys()
+		errs = append(errs, err)
+		for _, key := range stored {
+			if isDerivedKey(key) && !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	errs = append(errs, deleteTokenSet(config.StorageProvider))
+	for _, key := range keys {
+		if derivedStorage, ok := storageForKey(config.StorageProvider, key); ok {
+			errs = append(errs, deleteTokenSet(derivedStorage))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// deleteTokenSet deletes the token set of the storage provider, if there is one.
+func deleteTokenSet(provider storage.StorageProvider) error {
+	if err := provider.DeleteToken(); err != nil && !errors.Is(err, storage.ErrTokenNotFound) {
+		return err
+	}
+	return nil
+}
+
+// FetchResourceToken returns a token set for the given resource indicator (RFC 8707), or the
+// login token set if resource is empty. The token set is read from the per-resource cache if
+// possible. Otherwise a downscoped token is obtained with the refresh token of the login token
+// set, or with a new client credentials request, and stored in the cache. Expired token sets
+// are refreshed.
+func FetchResourceToken(ctx context.Context, config Config, resource string) (*TokenSet, error) {
+	return fetchToken(ctx, config, tokenRequest{resource: resource})
+}
+
+// tokenRequest describes the token set requested from fetchToken.
+type tokenRequest struct {
+	// resource selects the token set of a resource indicator instead of the login token set
+	resource string
+	// minValid is the minimum remaining lifetime of the access token
+	minValid time.Duration
+	// rejected is an access token that was rejected by a resource server and must be replaced
+	rejected string
+}
+
+// needsRefresh reports whether the token set does not satisfy the request.
+func (r tokenRequest) needsRefresh(tokenSet TokenSet) bool {
+	return !tokenSet.Valid() || tokenSet.ExpiresWithin(r.minValid) || (r.rejected != "" && tokenSet.AccessToken == r.rejected)
+}
+
+// fetchToken returns the requested token set from storage, refreshing it if needed. If the
+// storage provider implements storage.Locker, the lock is held while the token set is refreshed,
+// so that concurrent processes do not invalidate each other's rotated refresh tokens.
+func fetchToken(ctx context.Context, config Config, request tokenRequest) (*TokenSet, error) {
+	if tokenSet, err := storedToken(config, request); err != nil || tokenSet != nil {
+		return tokenSet, err
+	}
+
+	unlock, err := lockStorage(ctx, config.StorageProvider)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Another process may have refreshed the token set while we were waiting for the lock
+	if tokenSet, err := storedToken(config, request); err != nil || tokenSet != nil {
+		return tokenSet, err
+	}
+
+	tokenSet, err := LoadTokenSet(config.StorageProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	if isLoginTokenRequest(*tokenSet, request) {
+		return refreshLoginToken(ctx, config, request, tokenSet)
+	}
+
+	resources := []string{request.resource}
+	response, err := requestNewToken(ctx, config, tokenSet, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	// The provider may rotate the refresh token, so keep the login token set up to date
+	if response.RefreshToken != "" && response.RefreshToken != tokenSet.RefreshToken {
+		tokenSet.RefreshToken = response.RefreshToken
+		if err := SaveTokenSet(config.StorageProvider, *tokenSet); err != nil {
+			return nil, err
+		}
+	}
+
+	resourceTokenSet := NewTokenSet(*response, resources)
+	resourceTokenSet.RefreshToken = ""
+	resourceTokenSet.Session = tokenSet.Session
+	if resourceStorage, cacheable := storageForKey(config.StorageProvider, resourceKey(request.resource)); cacheable {
+		if err := SaveTokenSet(resourceStorage, *resourceTokenSet); err != nil {
+			return nil, err
+		}
+	}
+
+	return resourceTokenSet, nil
+}
+
+// storedToken returns the requested token set from storage, or nil if it has to be refreshed.
+func storedToken(config Config, request tokenRequest) (*TokenSet, error) {
+	tokenSet, err := LoadTokenSet(config.StorageProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	if isLoginTokenRequest(*tokenSet, request) {
+		if request.needsRefresh(*tokenSet) {
+			return nil, nil
+		}
+		return tokenSet, nil
+	}
+
+	resourceStorage, cacheable := storageForKey(config.StorageProvider, resourceKey(request.resource))
+	if !cacheable {
+		return nil, nil
+	}
+
+	cached, err := LoadTokenSet(resourceStorage)
+	if err != nil {
+		return nil, nil
+	}
+
+	if cached.Session != tokenSet.Session || !slices.Equal(cached.Resources, []string{request.resource}) || request.needsRefresh(*cached) {
+		return nil, nil
+	}
+
+	return cached, nil
+}
+
+// isLoginTokenRequest reports whether the request is served by the login token set.
+func isLoginTokenRequest(tokenSet TokenSet, request tokenRequest) bool {
+	return request.resource == "" || slices.Equal(tokenSet.Resources, []string{request.resource})
+}
+
+// lockStorage acquires the lock of the storage provider if it implements storage.Locker.
+func lockStorage(ctx context.Context, provider storage.StorageProvider) (func(), error) {
+	locker, ok := provider.(storage.Locker)
+	if !ok {
+		return func() {}, nil
+	}
+
+	unlock, err := locker.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		_ = unlock()
+	}, nil
+}
+
+// refreshLoginToken replaces the access token of the login token set.
+func refreshLoginToken(ctx context.Context, config Config, request tokenRequest, tokenSet *TokenSet) (*TokenSet, error) {
+	response, err := requestNewToken(ctx, config, tokenSet, tokenSet.Resources)
+	if err != nil {
+		// A token that is still valid but does not satisfy minValid remains usable
+		if errors.Is(err, storage.ErrTokenNotFound) && tokenSet.Valid() && tokenSet.AccessToken != request.rejected {
+			return tokenSet, nil
+		}
+		return nil, err
+	}
+
+	refreshed := NewTokenSet(*response, tokenSet.Resources)
+	refreshed.Session = tokenSet.Session
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = tokenSet.RefreshToken
+	}
+	if refreshed.Scope == "" {
+		refreshed.Scope = tokenSet.Scope
+	}
+	if refreshed.IDToken == "" {
+		refreshed.IDToken = tokenSet.IDToken
+	}
+
+	if err := SaveTokenSet(config.StorageProvider, *refreshed); err != nil {
+		return nil, err
+	}
+
+	return refreshed, nil
+}
+
+// requestNewToken obtains a new access token for the given resources without user interaction.
+func requestNewToken(ctx context.Context, config Config, tokenSet *TokenSet, resources []string) (*AccessTokenResponse, error) {
+	switch {
+	case config.GrantType == ClientCredentials:
+		resourceConfig := config
+		resourceConfig.Resources = resources
+		return FetchClientCredentialsToken(ctx, resourceConfig)
+	case tokenSet.RefreshToken != "":
+		return RefreshAccessToken(ctx, config, tokenSet.RefreshToken, resources)
+	default:
+		return nil, fmt.Errorf("%w: no refresh token available", storage.ErrTokenNotFound)
+	}
+}
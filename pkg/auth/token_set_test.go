@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTokenSet(t *testing.T) {
+	t.Run("token set", func(t *testing.T) {
+		provider := storage.NewMemoryStorage("test")
+		expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+
+		err := SaveTokenSet(provider, TokenSet{
+			AccessToken:  "access",
+			TokenType:    "Bearer",
+			RefreshToken: "refresh",
+			Expiry:       expiry,
+		})
+		assert.NoError(t, err)
+
+		tokenSet, err := LoadTokenSet(provider)
+		assert.NoError(t, err)
+		assert.Equal(t, "access", tokenSet.AccessToken)
+		assert.Equal(t, "refresh", tokenSet.RefreshToken)
+		assert.True(t, expiry.Equal(tokenSet.Expiry))
+		assert.True(t, tokenSet.Valid())
+	})
+
+	t.Run("legacy raw token", func(t *testing.T) {
+		provider := storage.NewMemoryStorage("test")
+		assert.NoError(t, provider.SetToken(jwt.Token{Raw: "raw_token"}))
+
+		tokenSet, err := LoadTokenSet(provider)
+		assert.NoError(t, err)
+		assert.Equal(t, "raw_token", tokenSet.AccessToken)
+		assert.True(t, tokenSet.Expiry.IsZero())
+		assert.True(t, tokenSet.Valid())
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		_, err := LoadTokenSet(storage.NewMemoryStorage("test"))
+		assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+	})
+}
+
+func TestTokenSet_ExpiresWithin(t *testing.T) {
+	tokenSet := TokenSet{AccessToken: "access", Expiry: time.Now().Add(time.Minute)}
+	assert.False(t, tokenSet.ExpiresWithin(30*time.Second))
+	assert.True(t, tokenSet.ExpiresWithin(2*time.Minute))
+
+	tokenSet.Expiry = time.Now().Add(-time.Minute)
+	assert.False(t, tokenSet.Valid())
+}
+
+func TestFetchResourceToken(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, RefreshToken.String(), r.PostForm.Get("grant_type"))
+		assert.Equal(t, "refresh", r.PostForm.Get("refresh_token"))
+		assert.Equal(t, []string{"https://api.example.com"}, r.PostForm["resource"])
+
+		if _, err := w.Write([]byte(`{"access_token":"resource_token","token_type":"Bearer","expires_in":3600,"refresh_token":"rotated"}`)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	config := Config{
+		ClientId:        "client_id",
+		TokenEndpoint:   server.URL,
+		StorageProvider: storage.NewMemoryStorage("test"),
+		GrantType:       DeviceCode,
+	}
+
+	_, err := SaveLoginTokenSet(config, AccessTokenResponse{
+		AccessToken:  "login_token",
+		ExpiresIn:    3600,
+		RefreshToken: "refresh",
+	})
+	assert.NoError(t, err)
+
+	tokenSet, err := FetchResourceToken(context.Background(), config, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "login_token", tokenSet.AccessToken)
+
+	tokenSet, err = FetchResourceToken(context.Background(), config, "https://api.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "resource_token", tokenSet.AccessToken)
+	assert.Empty(t, tokenSet.RefreshToken)
+	assert.Equal(t, 1, requests)
+
+	// The rotated refresh token is persisted in the login token set
+	loginTokenSet, err := LoadTokenSet(config.StorageProvider)
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", loginTokenSet.RefreshToken)
+	assert.Equal(t, "login_token", loginTokenSet.AccessToken)
+
+	// The second request is served from the cache
+	tokenSet, err = FetchResourceToken(context.Background(), config, "https://api.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "resource_token", tokenSet.AccessToken)
+	assert.Equal(t, 1, requests)
+
+	// A new login invalidates the cache
+	_, err = SaveLoginTokenSet(config, AccessTokenResponse{AccessToken: "new_login_token", RefreshToken: "refresh"})
+	assert.NoError(t, err)
+
+	_, err = FetchResourceToken(context.Background(), config, "https://api.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestRefreshKeepsIDToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(`{"access_token":"refreshed_token","token_type":"Bearer","expires_in":3600}`)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	config := Config{
+		ClientId:        "client_id",
+		TokenEndpoint:   server.URL,
+		StorageProvider: storage.NewMemoryStorage("test"),
+		GrantType:       DeviceCode,
+	}
+
+	loginTokenSet, err := SaveLoginTokenSet(config, AccessTokenResponse{
+		AccessToken:  "login_token",
+		RefreshToken: "refresh",
+		IDToken:      "id_token",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "id_token", loginTokenSet.IDToken)
+
+	tokenSet, err := fetchToken(context.Background(), config, tokenRequest{rejected: "login_token"})
+	assert.NoError(t, err)
+	assert.Equal(t, "refreshed_token", tokenSet.AccessToken)
+	assert.Equal(t, "id_token", tokenSet.IDToken)
+}
+
+func TestFetchTokenWaitsForStorageLock(t *testing.T) {
+	var refreshes atomic.Int32
+	tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+	defer tokenServer.Close()
+
+	lockPath := filepath.Join(t.TempDir(), "test.lock")
+	config := Config{
+		ClientId:        "client_id",
+		TokenEndpoint:   tokenServer.URL,
+		StorageProvider: storage.NewLockedStorage(storage.NewMemoryStorage("test"), lockPath),
+		GrantType:       DeviceCode,
+	}
+	assert.NoError(t, SaveTokenSet(config.StorageProvider, TokenSet{
+		AccessToken:  "expired",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(-time.Minute),
+	}))
+
+	// Another process holds the lock while it refreshes the token
+	unlock, err := storage.NewFileLock(lockPath).Lock(context.Background())
+	assert.NoError(t, err)
+
+	result := make(chan *TokenSet)
+	go func() {
+		tokenSet, err := fetchToken(context.Background(), config, tokenRequest{})
+		assert.NoError(t, err)
+		result <- tokenSet
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, SaveTokenSet(config.StorageProvider, TokenSet{
+		AccessToken:  "refreshed_by_other_process",
+		RefreshToken: "rotated",
+		Expiry:       time.Now().Add(time.Hour),
+	}))
+	assert.NoError(t, unlock())
+
+	tokenSet := <-result
+	assert.Equal(t, "refreshed_by_other_process", tokenSet.AccessToken)
+	assert.Equal(t, int32(0), refreshes.Load())
+}
+
+func TestLogoutDeletesDerivedTokenSets(t *testing.T) {
+	var refreshes atomic.Int32
+	tokenServer := newRefreshServer(t, "resource_token", &refreshes)
+	defer tokenServer.Close()
+
+	provider := storage.NewMemoryStorage("test")
+	options := []Option{
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint(tokenServer.URL),
+		WithStorageProvider(provider),
+	}
+
+	config, err := configure(options...)
+	assert.NoError(t, err)
+	_, err = SaveLoginTokenSet(*config, AccessTokenResponse{AccessToken: "login_token", RefreshToken: "refresh"})
+	assert.NoError(t, err)
+
+	// A resource that is not configured, e.g. requested by exec --resource
+	_, err = FetchResourceToken(context.Background(), *config, "https://api.example.com")
+	assert.NoError(t, err)
+	resourceStorage, _ := storageForKey(provider, resourceKey("https://api.example.com"))
+	_, err = resourceStorage.GetToken()
+	assert.NoError(t, err)
+
+	cmd := NewLogoutCommand(options...)
+	cmd.SetArgs(nil)
+	cmd.SetOut(&bytes.Buffer{})
+	assert.NoError(t, cmd.Execute())
+
+	_, err = provider.GetToken()
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+	_, err = resourceStorage.GetToken()
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+	keys, err := provider.(storage.KeyedStorageProvider).Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestLogoutWithoutLoginTokenSet(t *testing.T) {
+	provider := storage.NewMemoryStorage("test")
+	resourceStorage, _ := storageForKey(provider, resourceKey("https://api.example.com"))
+	assert.NoError(t, SaveTokenSet(resourceStorage, TokenSet{AccessToken: "resource_token"}))
+
+	cmd := NewLogoutCommand(
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint("https://example.com/token"),
+		WithStorageProvider(notFoundOnDelete{provider.(storage.KeyedStorageProvider)}),
+	)
+	cmd.SetArgs(nil)
+	cmd.SetOut(&bytes.Buffer{})
+	assert.NoError(t, cmd.Execute())
+
+	_, err := resourceStorage.GetToken()
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+}
+
+// notFoundOnDelete reports a missing token on DeleteToken like the keyring does.
+type notFoundOnDelete struct {
+	storage.KeyedStorageProvider
+}
+
+func (p notFoundOnDelete) WithKey(key string) storage.StorageProvider {
+	return notFoundOnDelete{p.KeyedStorageProvider.WithKey(key).(storage.KeyedStorageProvider)}
+}
+
+func (p notFoundOnDelete) DeleteToken() error {
+	if _, err := p.GetToken(); err != nil {
+		return err
+	}
+	return p.KeyedStorageProvider.DeleteToken()
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"golang.org/x/oauth2"
+)
+
+// TokenSource is an oauth2.TokenSource that returns the stored access token and refreshes it
+// before it expires. It is safe for concurrent use. It must be created with NewTokenSource,
+// NewResourceTokenSource or TokenManager.TokenSource; any other TokenSource returns an error.
+type TokenSource struct {
+	manager *TokenManager
+}
+
+// NewTokenSource creates a TokenSource for the given configuration.
+func NewTokenSource(options ...Option) (*TokenSource, error) {
+	authConfig, err := configure(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTokenManager(*authConfig, "").TokenSource(), nil
+}
+
+// NewResourceTokenSource creates a TokenSource that returns the token of the given resource
+// indicator (RFC 8707) instead of the login token.
+func NewResourceTokenSource(resource string, options ...Option) (*TokenSource, error) {
+	manager, err := NewResourceTokenManager(resource, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return manager.TokenSource(), nil
+}
+
+// Token implements oauth2.TokenSource.
+func (s *TokenSource) Token() (*oauth2.Token, error) {
+	return s.TokenWithContext(context.Background())
+}
+
+// TokenWithContext is like Token, but uses ctx for requests to the token endpoint.
+func (s *TokenSource) TokenWithContext(ctx context.Context) (*oauth2.Token, error) {
+	tokenSet, err := s.manager.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenSet.OAuth2Token(), nil
+}
+
+// OAuth2Token converts the token set to an oauth2.Token. The refresh token is not included,
+// refreshing is left to the library.
+func (t TokenSet) OAuth2Token() *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken: t.AccessToken,
+		TokenType:   t.Type(),
+		Expiry:      t.Expiry,
+	}
+}
+
+// storageTokenSource persists the tokens of another oauth2.TokenSource in a storage provider.
+type storageTokenSource struct {
+	provider storage.StorageProvider
+	source   oauth2.TokenSource
+	mutex    sync.Mutex
+}
+
+// NewStorageTokenSource returns an oauth2.TokenSource that serves tokens from the storage
+// provider and only calls source when the stored token is missing or about to expire. The
+// tokens returned by source are written back to the storage provider, so they are shared
+// with the commands and other consumers of this library.
+func NewStorageTokenSource(provider storage.StorageProvider, source oauth2.TokenSource) oauth2.TokenSource {
+	return &storageTokenSource{
+		provider: provider,
+		source:   source,
+	}
+}
+
+// Token implements oauth2.TokenSource.
+func (s *storageTokenSource) Token() (*oauth2.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if tokenSet, err := LoadTokenSet(s.provider); err == nil && tokenSet.Valid() && !tokenSet.ExpiresWithin(DefaultExpiryDelta) {
+		return tokenSet.OAuth2Token(), nil
+	}
+
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSet := TokenSet{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	}
+	if scope, ok := token.Extra("scope").(string); ok {
+		tokenSet.Scope = scope
+	}
+
+	if err := SaveTokenSet(s.provider, tokenSet); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenSource_Token(t *testing.T) {
+	var refreshes atomic.Int32
+	tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+	defer tokenServer.Close()
+
+	provider := newTestStorage(t, TokenSet{
+		AccessToken:  "expired",
+		RefreshToken: "refresh",
+		TokenType:    "bearer",
+		Expiry:       time.Now().Add(-time.Minute),
+	})
+
+	tokenSource, err := NewTokenSource(
+		WithClientID("client_id"),
+		WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		WithTokenEndpoint(tokenServer.URL),
+		WithStorageProvider(provider),
+	)
+	assert.NoError(t, err)
+
+	// The token source can be used wherever golang.org/x/oauth2 is expected
+	reuseTokenSource := oauth2.ReuseTokenSource(nil, tokenSource)
+
+	token, err := reuseTokenSource.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "refreshed", token.AccessToken)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Empty(t, token.RefreshToken)
+	assert.True(t, token.Valid())
+
+	_, err = reuseTokenSource.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), refreshes.Load())
+}
+
+// countingTokenSource returns a new token on every call.
+type countingTokenSource struct {
+	calls atomic.Int32
+}
+
+func (s *countingTokenSource) Token() (*oauth2.Token, error) {
+	s.calls.Add(1)
+	return &oauth2.Token{
+		AccessToken:  "external",
+		TokenType:    "Bearer",
+		RefreshToken: "external_refresh",
+		Expiry:       time.Now().Add(time.Hour),
+	}, nil
+}
+
+func TestStorageTokenSource_Token(t *testing.T) {
+	provider := storage.NewMemoryStorage("test")
+	source := &countingTokenSource{}
+
+	tokenSource := NewStorageTokenSource(provider, source)
+
+	token, err := tokenSource.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "external", token.AccessToken)
+
+	// The token is persisted and served from storage
+	tokenSet, err := LoadTokenSet(provider)
+	assert.NoError(t, err)
+	assert.Equal(t, "external", tokenSet.AccessToken)
+	assert.Equal(t, "external_refresh", tokenSet.RefreshToken)
+
+	token, err = NewStorageTokenSource(provider, source).Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "external", token.AccessToken)
+	assert.Equal(t, int32(1), source.calls.Load())
+}
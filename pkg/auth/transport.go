@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Transport is an http.RoundTripper that authenticates requests with the stored access token.
+// Tokens that expire within DefaultExpiryDelta are refreshed before the request is sent, and a
+// request that is rejected because of an invalid token is retried once with a refreshed token.
+// A Transport is safe for concurrent use. It must be created with NewTransport,
+// NewResourceTransport or TokenManager.Transport; requests sent through any other Transport fail.
+type Transport struct {
+	// Base is the underlying round tripper. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	manager *TokenManager
+}
+
+// NewTransport creates a Transport for the given configuration.
+func NewTransport(options ...Option) (*Transport, error) {
+	authConfig, err := configure(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTokenManager(*authConfig, "").Transport(nil), nil
+}
+
+// NewResourceTransport creates a Transport that sends the token of the given resource
+// indicator (RFC 8707) instead of the login token.
+func NewResourceTransport(resource string, options ...Option) (*Transport, error) {
+	manager, err := NewResourceTokenManager(resource, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return manager.Transport(nil), nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tokenSet, err := t.manager.Token(req.Context())
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	// The body of the original request is consumed by the first attempt, so a retry
+	// is only possible if it can be recreated
+	retryable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	resp, err := t.base().RoundTrip(authorizeRequest(req, *tokenSet))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !retryable || !isInvalidTokenChallenge(resp.Header) {
+		return resp, err
+	}
+
+	refreshed, err := t.manager.Refresh(req.Context(), tokenSet.AccessToken)
+	if err != nil {
+		// Hand out the original response, the caller is better served with the 401
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return t.base().RoundTrip(authorizeRequest(retry, *refreshed))
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// authorizeRequest returns a copy of the request with the Authorization header set.
+func authorizeRequest(req *http.Request, tokenSet TokenSet) *http.Request {
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", tokenSet.Type()+" "+tokenSet.AccessToken)
+	return authorized
+}
+
+// isInvalidTokenChallenge reports whether the WWW-Authenticate header of a response carries
+// a Bearer challenge with the invalid_token error code (RFC 6750).
+func isInvalidTokenChallenge(header http.Header) bool {
+	for _, challenge := range header.Values("WWW-Authenticate") {
+		challenge = strings.ToLower(challenge)
+		if strings.HasPrefix(challenge, "bearer") && strings.Contains(challenge, `error="invalid_token"`) {
+			return true
+		}
+	}
+	return false
+}
+
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport_RoundTrip(t *testing.T) {
+	t.Run("attaches token with token type", func(t *testing.T) {
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "DPoP access", r.Header.Get("Authorization"))
+		}))
+		defer api.Close()
+
+		transport := newTestTokenManager(t, "https://example.com/token", TokenSet{
+			AccessToken: "access",
+			TokenType:   "DPoP",
+			Expiry:      time.Now().Add(time.Hour),
+		}).Transport(nil)
+
+		resp, err := (&http.Client{Transport: transport}).Get(api.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	})
+
+	t.Run("refreshes token near expiry", func(t *testing.T) {
+		var refreshes atomic.Int32
+		tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+		defer tokenServer.Close()
+
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer refreshed", r.Header.Get("Authorization"))
+		}))
+		defer api.Close()
+
+		transport := newTestTokenManager(t, tokenServer.URL, TokenSet{
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			Expiry:       time.Now().Add(10 * time.Second),
+		}).Transport(nil)
+
+		resp, err := (&http.Client{Transport: transport}).Get(api.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, int32(1), refreshes.Load())
+
+		// The refreshed token is persisted
+		tokenSet, err := LoadTokenSet(transport.manager.config.StorageProvider)
+		assert.NoError(t, err)
+		assert.Equal(t, "refreshed", tokenSet.AccessToken)
+		assert.Equal(t, "refresh", tokenSet.RefreshToken)
+	})
+
+	t.Run("retries once on invalid token", func(t *testing.T) {
+		var refreshes atomic.Int32
+		tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+		defer tokenServer.Close()
+
+		var attempts atomic.Int32
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			body := make([]byte, 4)
+			_, _ = r.Body.Read(body)
+			assert.Equal(t, "body", string(body))
+
+			if r.Header.Get("Authorization") != "Bearer refreshed" {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="revoked"`)
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		defer api.Close()
+
+		transport := newTestTokenManager(t, tokenServer.URL, TokenSet{
+			AccessToken:  "revoked",
+			RefreshToken: "refresh",
+			Expiry:       time.Now().Add(time.Hour),
+		}).Transport(nil)
+
+		resp, err := (&http.Client{Transport: transport}).Post(api.URL, "text/plain", strings.NewReader("body"))
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int32(2), attempts.Load())
+		assert.Equal(t, int32(1), refreshes.Load())
+	})
+
+	t.Run("does not retry other 401 responses", func(t *testing.T) {
+		var refreshes atomic.Int32
+		tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+		defer tokenServer.Close()
+
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer api.Close()
+
+		transport := newTestTokenManager(t, tokenServer.URL, TokenSet{
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			Expiry:       time.Now().Add(time.Hour),
+		}).Transport(nil)
+
+		resp, err := (&http.Client{Transport: transport}).Get(api.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, int32(0), refreshes.Load())
+	})
+
+	t.Run("refreshes once for concurrent requests", func(t *testing.T) {
+		var refreshes atomic.Int32
+		tokenServer := newRefreshServer(t, "refreshed", &refreshes)
+		defer tokenServer.Close()
+
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer refreshed", r.Header.Get("Authorization"))
+		}))
+		defer api.Close()
+
+		transport := newTestTokenManager(t, tokenServer.URL, TokenSet{
+			AccessToken:  "expired",
+			RefreshToken: "refresh",
+			Expiry:       time.Now().Add(-time.Minute),
+		}).Transport(nil)
+		client := &http.Client{Transport: transport}
+
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := client.Get(api.URL)
+				if assert.NoError(t, err) {
+					resp.Body.Close()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), refreshes.Load())
+	})
+}
+
+func TestIsInvalidTokenChallenge(t *testing.T) {
+	header := http.Header{}
+	assert.False(t, isInvalidTokenChallenge(header))
+
+	header.Set("WWW-Authenticate", `Basic realm="api"`)
+	assert.False(t, isInvalidTokenChallenge(header))
+
+	header.Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+	assert.True(t, isInvalidTokenChallenge(header))
+}
+
+func TestTransportWithoutConstructor(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://api.example.com", nil)
+
+	_, err := (&Transport{Base: http.DefaultTransport}).RoundTrip(req)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	_, err = (&TokenSource{}).Token()
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"os"
 	"time"
 
 	"github.com/mdp/qrterminal"
@@ -17,7 +16,7 @@ func Handle(cmd cobra.Command, verificationURIComplete string) {
 	cmd.Println("2. Once the browser is open, you will be presented with a QR code or a link.")
 	cmd.Println("   - If the browser supports scanning QR codes, use the built-in QR code scanner to scan the code provided below:")
 	cmd.Println()
-	qrterminal.GenerateHalfBlock(verificationURIComplete, qrterminal.L, os.Stdout)
+	qrterminal.GenerateHalfBlock(verificationURIComplete, qrterminal.L, cmd.OutOrStderr())
 	cmd.Println()
 	cmd.Println("   - If your browser does not support QR code scanning,")
 	cmd.Println("     you can copy and paste the link provided below into the address bar of your browser:")
@@ -37,3 +36,40 @@ func Handle(cmd cobra.Command, verificationURIComplete string) {
 		cmd.Printf("  %s\n", verificationURIComplete)
 	}
 }
+
+func HandleAuthorizationURL(cmd cobra.Command, authorizationURL string) {
+	cmd.Println("Please complete the authentication process in your browser.")
+	cmd.Println()
+	cmd.Println("If the browser does not open automatically, navigate to the following URL manually:")
+	cmd.Println()
+	cmd.Printf("  %s\n", authorizationURL)
+	cmd.Println()
+
+	if err := browser.OpenURL(authorizationURL); err != nil {
+		cmd.Println("Failed to open browser. Please navigate to the URL above manually.")
+	}
+}
+
+func HandleLogoutURL(cmd cobra.Command, endSessionURL string) {
+	cmd.Println("Please complete the logout in your browser.")
+	cmd.Println()
+	cmd.Println("If the browser does not open automatically, navigate to the following URL manually:")
+	cmd.Println()
+	cmd.Printf("  %s\n", endSessionURL)
+	cmd.Println()
+
+	if err := browser.OpenURL(endSessionURL); err != nil {
+		cmd.Println("Failed to open browser. Please navigate to the URL above manually.")
+	}
+}
+
+func HandleBackchannelAuthentication(cmd cobra.Command, loginHint, bindingMessage string) {
+	cmd.Printf("An approval request was sent to the device of %s.\n", loginHint)
+	if bindingMessage != "" {
+		cmd.Println("Please confirm that the request shows the following message:")
+		cmd.Println()
+		cmd.Printf("  %s\n", bindingMessage)
+	}
+	cmd.Println()
+	cmd.Println("Waiting for approval...")
+}
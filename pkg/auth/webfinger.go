@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IssuerRelation is the WebFinger link relation of the OpenID Connect issuer.
+const IssuerRelation = "http://openid.net/specs/connect/1.0/issuer"
+
+// webFingerResponse is the JSON Resource Descriptor (RFC 7033) returned by WebFinger.
+type webFingerResponse struct {
+	Subject string `json:"subject"`
+	Links   []struct {
+		Rel  string `json:"rel"`
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+// DiscoverIssuer finds the issuer of the user with the given email address with OpenID Connect
+// WebFinger discovery. The WebFinger endpoint is queried on the host of the email address, and
+// the issuer must be an HTTPS URL.
+func DiscoverIssuer(ctx context.Context, email string) (string, error) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", fmt.Errorf("%w: invalid email address %s", ErrInvalidConfig, email)
+	}
+
+	return webFingerIssuer(ctx, "https://"+email[at+1:], "acct:"+email)
+}
+
+// webFingerIssuer queries the WebFinger endpoint of the host at baseURL for the issuer of
+// resource.
+func webFingerIssuer(ctx context.Context, baseURL, resource string) (string, error) {
+	query := url.Values{
+		"resource": []string{resource},
+		"rel":      []string{IssuerRelation},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/.well-known/webfinger?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	request.Header.Set("Accept", "application/jrd+json, application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrHTTPFailure, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: WebFinger returned status %d", ErrInvalidResponse, response.StatusCode)
+	}
+
+	var descriptor webFingerResponse
+	if err := json.NewDecoder(response.Body).Decode(&descriptor); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	for _, link := range descriptor.Links {
+		if link.Rel != IssuerRelation || link.Href == "" {
+			continue
+		}
+		// the issuer is trusted with the credentials of the user, so it must be served over HTTPS
+		if issuer, err := url.Parse(link.Href); err != nil || issuer.Scheme != "https" || issuer.Host == "" {
+			return "", fmt.Errorf("%w: issuer %q for %s is not an HTTPS URL", ErrInvalidResponse, link.Href, resource)
+		}
+		return link.Href, nil
+	}
+
+	return "", fmt.Errorf("%w: no issuer found for %s", ErrInvalidResponse, resource)
+}
+
+// overrideIssuer sets the issuer after all options, the configuration file and flags, and
+// discards the configured endpoints, so that they are discovered from the issuer.
+func overrideIssuer(issuer string) Option {
+	return func(c *Config) {
+		c.overrides = append(c.overrides, func(c *Config) {
+			c.setIssuer(issuer)
+		})
+	}
+}
+
+// saveProfileIssuer stores the issuer in the selected profile of the configuration file, if one
+// is configured. The endpoints of the profile are removed, since they belong to the previous
+// issuer. It reports whether the issuer was stored.
+func saveProfileIssuer(authConfig Config, issuer string) (bool, error) {
+	if authConfig.ConfigFile == "" {
+		return false, nil
+	}
+
+	file, err := LoadConfigFile(authConfig.ConfigFile)
+	if err != nil {
+		return false, err
+	}
+
+	for _, key := range []string{"authorization_url", "auth_url", "par_url", "token_url", "registration_url", "end_session_url", "backchannel_authentication_url"} {
+		if err := file.Set(authConfig.Profile, key, ""); err != nil {
+			return false, err
+		}
+	}
+	if err := file.Set(authConfig.Profile, "issuer", issuer); err != nil {
+		return false, err
+	}
+
+	return true, file.Save(authConfig.ConfigFile)
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebFingerIssuer(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "issuer link",
+			status: http.StatusOK,
+			body:   `{"subject": "acct:alice@corp.example", "links": [{"rel": "self", "href": "https://corp.example/alice"}, {"rel": "http://openid.net/specs/connect/1.0/issuer", "href": "https://idp.example.com/corp"}]}`,
+			want:   "https://idp.example.com/corp",
+		},
+		{
+			name:    "http issuer",
+			status:  http.StatusOK,
+			body:    `{"subject": "acct:alice@corp.example", "links": [{"rel": "http://openid.net/specs/connect/1.0/issuer", "href": "http://idp.example.com/corp"}]}`,
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name:    "relative issuer",
+			status:  http.StatusOK,
+			body:    `{"subject": "acct:alice@corp.example", "links": [{"rel": "http://openid.net/specs/connect/1.0/issuer", "href": "/corp"}]}`,
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name:    "no issuer link",
+			status:  http.StatusOK,
+			body:    `{"subject": "acct:alice@corp.example", "links": []}`,
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name:    "not found",
+			status:  http.StatusNotFound,
+			wantErr: ErrInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/.well-known/webfinger", r.URL.Path)
+				assert.Equal(t, "acct:alice@corp.example", r.URL.Query().Get("resource"))
+				assert.Equal(t, IssuerRelation, r.URL.Query().Get("rel"))
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			issuer, err := webFingerIssuer(context.Background(), server.URL, "acct:alice@corp.example")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, issuer)
+		})
+	}
+}
+
+func TestDiscoverIssuerInvalidEmail(t *testing.T) {
+	for _, email := range []string{"alice", "@corp.example", "alice@"} {
+		_, err := DiscoverIssuer(context.Background(), email)
+		assert.ErrorIs(t, err, ErrInvalidConfig, email)
+	}
+}
+
+func TestLoginWithEmail(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/webfinger":
+			assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+				"subject": r.URL.Query().Get("resource"),
+				"links":   []map[string]string{{"rel": IssuerRelation, "href": server.URL + "/corp"}},
+			}))
+		case "/corp/.well-known/openid-configuration":
+			assert.NoError(t, json.NewEncoder(w).Encode(AuthorizationServerMetadataResponse{
+				Issuer:        server.URL + "/corp",
+				TokenEndpoint: server.URL + "/corp/token",
+			}))
+		case "/corp/token":
+			assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "corp_token",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			}))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// WebFinger is always queried over HTTPS, so trust the test server
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	t.Cleanup(func() {
+		http.DefaultTransport = defaultTransport
+	})
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	path := writeConfigFile(t, "config.yaml", "profiles:\n  default:\n    token_url: https://old.example.com/token\n")
+	provider := storage.NewMemoryStorage("test")
+
+	cmd := NewLoginCommand(
+		WithClientID("client_id"),
+		WithGrantType(ClientCredentials),
+		WithStorageProvider(provider),
+		WithConfigFile(path),
+	)
+	cmd.SetArgs([]string{"--email", "alice@" + serverURL.Host})
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	require.NoError(t, cmd.Execute())
+
+	profileStorage, _ := storageForKey(provider, profileStorageKeyPrefix+DefaultProfile)
+	tokenSet, err := LoadTokenSet(profileStorage)
+	require.NoError(t, err)
+	assert.Equal(t, "corp_token", tokenSet.AccessToken)
+
+	file, err := LoadConfigFile(path)
+	require.NoError(t, err)
+	issuer, _ := file.Get("", "issuer")
+	assert.Equal(t, server.URL+"/corp", issuer)
+	_, ok := file.Get("", "token_url")
+	assert.False(t, ok)
+}
+
+func TestLoginWithEmailRequiresConfigFile(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	cmd := NewLoginCommand(
+		WithClientID("client_id"),
+		WithGrantType(ClientCredentials),
+		WithStorageProvider(storage.NewMemoryStorage("test")),
+	)
+	cmd.SetArgs([]string{"--email", "alice@" + serverURL.Host})
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+
+	err = cmd.Execute()
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.Equal(t, ExitCodeConfig, ExitCode(err))
+	assert.Zero(t, requests.Load())
+}
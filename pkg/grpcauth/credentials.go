@@ -0,0 +1,72 @@
+// Package grpcauth provides gRPC per-RPC credentials backed by the tokens of the auth package.
+package grpcauth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nauthera/cobra-oauth2/pkg/auth"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/credentials"
+)
+
+// contextTokenSource is implemented by token sources that accept a context, such as auth.TokenSource.
+type contextTokenSource interface {
+	TokenWithContext(ctx context.Context) (*oauth2.Token, error)
+}
+
+// PerRPCCredentials implements credentials.PerRPCCredentials. It attaches the access token of
+// a token source to the authorization metadata of every RPC.
+type PerRPCCredentials struct {
+	// Insecure allows sending the token over connections without transport security.
+	// It is meant for local development only.
+	Insecure bool
+
+	source oauth2.TokenSource
+}
+
+// NewPerRPCCredentials creates per-RPC credentials from the stored token set of the given
+// configuration. The token is refreshed automatically before it expires.
+func NewPerRPCCredentials(options ...auth.Option) (*PerRPCCredentials, error) {
+	tokenSource, err := auth.NewTokenSource(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPerRPCCredentialsFromTokenSource(tokenSource), nil
+}
+
+// NewPerRPCCredentialsFromTokenSource creates per-RPC credentials from a token source.
+func NewPerRPCCredentialsFromTokenSource(source oauth2.TokenSource) *PerRPCCredentials {
+	return &PerRPCCredentials{source: source}
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c *PerRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if c.RequireTransportSecurity() {
+		requestInfo, _ := credentials.RequestInfoFromContext(ctx)
+		if err := credentials.CheckSecurityLevel(requestInfo.AuthInfo, credentials.PrivacyAndIntegrity); err != nil {
+			return nil, fmt.Errorf("unable to transfer access token: %w", err)
+		}
+	}
+
+	var token *oauth2.Token
+	var err error
+	if source, ok := c.source.(contextTokenSource); ok {
+		token, err = source.TokenWithContext(ctx)
+	} else {
+		token, err = c.source.Token()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"authorization": token.Type() + " " + token.AccessToken,
+	}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c *PerRPCCredentials) RequireTransportSecurity() bool {
+	return !c.Insecure
+}
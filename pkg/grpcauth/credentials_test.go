@@ -0,0 +1,97 @@
+package grpcauth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nauthera/cobra-oauth2/pkg/auth"
+	"github.com/nauthera/cobra-oauth2/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startServer starts an in-process gRPC server and returns the authorization metadata it receives.
+func startServer(t *testing.T) (*bufconn.Listener, <-chan []string) {
+	listener := bufconn.Listen(1024 * 1024)
+	received := make(chan []string, 1)
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		received <- md.Get("authorization")
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	return listener, received
+}
+
+func dial(listener *bufconn.Listener, credentials *PerRPCCredentials) (*grpc.ClientConn, error) {
+	return grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(credentials),
+	)
+}
+
+func newCredentials(t *testing.T) *PerRPCCredentials {
+	provider := storage.NewMemoryStorage("test")
+	assert.NoError(t, auth.SaveTokenSet(provider, auth.TokenSet{
+		AccessToken: "access_token",
+		TokenType:   "bearer",
+		Expiry:      time.Now().Add(time.Hour),
+	}))
+
+	credentials, err := NewPerRPCCredentials(
+		auth.WithClientID("client_id"),
+		auth.WithDeviceAuthorizationEndpoint("https://example.com/device"),
+		auth.WithTokenEndpoint("https://example.com/token"),
+		auth.WithStorageProvider(provider),
+	)
+	assert.NoError(t, err)
+	return credentials
+}
+
+func TestPerRPCCredentials(t *testing.T) {
+	t.Run("sends authorization metadata", func(t *testing.T) {
+		listener, received := startServer(t)
+
+		credentials := newCredentials(t)
+		credentials.Insecure = true
+
+		conn, err := dial(listener, credentials)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Bearer access_token"}, <-received)
+	})
+
+	t.Run("requires transport security by default", func(t *testing.T) {
+		listener, _ := startServer(t)
+
+		credentials := newCredentials(t)
+		assert.True(t, credentials.RequireTransportSecurity())
+
+		conn, err := dial(listener, credentials)
+		if err == nil {
+			defer conn.Close()
+			_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		}
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,407 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// agentDialTimeout bounds connecting to the agent, so that a hanging agent does not block a CLI.
+const agentDialTimeout = 2 * time.Second
+
+// agentRequest is a single request sent to the agent. Requests and responses are exchanged as
+// newline-delimited JSON.
+type agentRequest struct {
+	Op    string `json:"op"`
+	Key   string `json:"key,omitempty"`
+	Token string `json:"token,omitempty"`
+}
+
+// agentResponse is the response of the agent to a single request.
+type agentResponse struct {
+	Token    string   `json:"token,omitempty"`
+	Keys     []string `json:"keys,omitempty"`
+	NotFound bool     `json:"not_found,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+const (
+	agentOpGet    = "get"
+	agentOpSet    = "set"
+	agentOpDelete = "delete"
+	agentOpKeys   = "keys"
+	agentOpLock   = "lock"
+	agentOpUnlock = "unlock"
+)
+
+// DefaultAgentSocketPath returns the path of the agent socket for the given service. The socket
+// is placed in $XDG_RUNTIME_DIR if it is set, and in a per-user directory in the temporary
+// directory otherwise.
+func DefaultAgentSocketPath(service string) string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "cobra-oauth2-"+strconv.Itoa(os.Getuid()))
+	} else {
+		dir = filepath.Join(dir, "cobra-oauth2")
+	}
+	return filepath.Join(dir, unsafeFileNameCharacters.ReplaceAllString(service, "_")+".sock")
+}
+
+// ListenAgent creates the agent socket at path. The socket is only accessible by the current
+// user: its directory is created with mode 0700 if it does not exist, and must not be
+// accessible by other users otherwise, so that the socket cannot be reached before its own
+// permissions are restricted. A stale socket of an agent that is no longer running is replaced.
+func ListenAgent(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Join(ErrAgent, err)
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return nil, errors.Join(ErrAgent, err)
+	}
+	if !info.IsDir() || info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("%w: the socket directory %s must only be accessible by the current user (mode 0700)", ErrAgent, dir)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, agentDialTimeout); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: an agent is already listening on %s", ErrAgent, path)
+	}
+	_ = os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Join(ErrAgent, err)
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, errors.Join(ErrAgent, err)
+	}
+
+	return listener, nil
+}
+
+// AgentServer serves the tokens of a storage provider to other processes of the same user.
+type AgentServer struct {
+	// OnChange is called with the key of a token that was set or deleted by a client.
+	OnChange func(key string)
+
+	provider StorageProvider
+}
+
+// NewAgentServer creates an agent server for the given storage provider. Clients connect to it
+// with the storage provider returned by NewAgentStorage.
+func NewAgentServer(provider StorageProvider) *AgentServer {
+	return &AgentServer{provider: provider}
+}
+
+// Serve accepts connections on the listener until ctx is done. Connections from processes of
+// other users are rejected.
+func (s *AgentServer) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Join(ErrAgent, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+
+			if err := checkPeer(conn); err != nil {
+				return
+			}
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// serveConn handles the requests of a single connection.
+func (s *AgentServer) serveConn(ctx context.Context, conn net.Conn) {
+	// A lock is bound to the connection and released when the client disconnects
+	locked := false
+	unlock := func() error { return nil }
+	defer func() {
+		_ = unlock()
+	}()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+	for {
+		var request agentRequest
+		if err := decoder.Decode(&request); err != nil {
+			return
+		}
+
+		var response agentResponse
+		switch request.Op {
+		case agentOpLock:
+			// A second lock would replace the release of the first, which would be held forever
+			if locked {
+				response.Error = "the lock is already held by this connection"
+				break
+			}
+			locker, ok := s.provider.(Locker)
+			if ok {
+				release, err := locker.Lock(ctx)
+				if err != nil {
+					response.Error = err.Error()
+				} else {
+					unlock = release
+					locked = true
+				}
+			}
+		case agentOpUnlock:
+			if err := unlock(); err != nil {
+				response.Error = err.Error()
+			}
+			unlock = func() error { return nil }
+			locked = false
+		default:
+			response = s.handle(request)
+		}
+
+		if err := encoder.Encode(response); err != nil {
+			return
+		}
+	}
+}
+
+// handle executes a token request against the storage provider.
+func (s *AgentServer) handle(request agentRequest) agentResponse {
+	provider := s.provider
+	keyed, isKeyed := s.provider.(KeyedStorageProvider)
+	if request.Key != "" || request.Op == agentOpKeys {
+		if !isKeyed {
+			return agentResponse{Error: "storage provider does not support keys"}
+		}
+		if request.Key != "" {
+			provider = keyed.WithKey(request.Key)
+		}
+	}
+
+	var err error
+	var response agentResponse
+	switch request.Op {
+	case agentOpGet:
+		response.Token, err = provider.GetToken()
+		if errors.Is(err, ErrTokenNotFound) {
+			return agentResponse{NotFound: true}
+		}
+	case agentOpSet:
+		err = provider.SetToken(jwt.Token{Raw: request.Token})
+	case agentOpDelete:
+		err = provider.DeleteToken()
+		if errors.Is(err, ErrTokenNotFound) {
+			return agentResponse{NotFound: true}
+		}
+	case agentOpKeys:
+		response.Keys, err = keyed.Keys()
+	default:
+		return agentResponse{Error: "unknown operation " + request.Op}
+	}
+
+	if err != nil {
+		return agentResponse{Error: err.Error()}
+	}
+
+	if request.Op != agentOpGet && request.Op != agentOpKeys && s.OnChange != nil {
+		s.OnChange(request.Key)
+	}
+
+	return response
+}
+
+// agentStorageProvider is a storage provider that forwards to an agent.
+type agentStorageProvider struct {
+	path string
+	key  string
+}
+
+// NewAgentStorage returns a storage provider that reads and writes tokens through the agent
+// listening on the socket at path. The agent must run as the same user.
+func NewAgentStorage(path string) KeyedStorageProvider {
+	return &agentStorageProvider{path: path}
+}
+
+// AgentAvailable reports whether an agent of the current user is listening on the socket at path.
+func AgentAvailable(path string) bool {
+	conn, err := dialAgent(context.Background(), path)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// WithKey implements KeyedStorageProvider.
+func (a *agentStorageProvider) WithKey(key string) StorageProvider {
+	return &agentStorageProvider{path: a.path, key: key}
+}
+
+// GetToken implements StorageProvider.
+func (a *agentStorageProvider) GetToken() (string, error) {
+	response, err := a.roundTrip(agentRequest{Op: agentOpGet, Key: a.key})
+	if err != nil {
+		return "", err
+	}
+
+	if response.NotFound {
+		return "", ErrTokenNotFound
+	}
+
+	return response.Token, nil
+}
+
+// SetToken implements StorageProvider.
+func (a *agentStorageProvider) SetToken(token jwt.Token) error {
+	if _, err := a.roundTrip(agentRequest{Op: agentOpSet, Key: a.key, Token: token.Raw}); err != nil {
+		return errors.Join(ErrSetToken, err)
+	}
+	return nil
+}
+
+// DeleteToken implements StorageProvider.
+func (a *agentStorageProvider) DeleteToken() error {
+	response, err := a.roundTrip(agentRequest{Op: agentOpDelete, Key: a.key})
+	if err != nil {
+		return errors.Join(ErrDeleteToken, err)
+	}
+
+	if response.NotFound {
+		return ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// Keys implements KeyedStorageProvider.
+func (a *agentStorageProvider) Keys() ([]string, error) {
+	response, err := a.roundTrip(agentRequest{Op: agentOpKeys})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Keys, nil
+}
+
+// Lock implements Locker. The lock is held by the agent until it is released or the
+// connection is closed.
+func (a *agentStorageProvider) Lock(ctx context.Context) (func() error, error) {
+	conn, err := dialAgent(ctx, a.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Closing the connection aborts waiting for the lock when ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
+	if _, err := exchange(encoder, decoder, agentRequest{Op: agentOpLock}); err != nil {
+		conn.Close()
+		return nil, errors.Join(ErrLock, err)
+	}
+
+	return func() error {
+		defer conn.Close()
+		_, err := exchange(encoder, decoder, agentRequest{Op: agentOpUnlock})
+		return err
+	}, nil
+}
+
+// roundTrip sends a single request to the agent.
+func (a *agentStorageProvider) roundTrip(request agentRequest) (*agentResponse, error) {
+	conn, err := dialAgent(context.Background(), a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return exchange(json.NewEncoder(conn), json.NewDecoder(conn), request)
+}
+
+// exchange sends a request and reads its response.
+func exchange(encoder *json.Encoder, decoder *json.Decoder, request agentRequest) (*agentResponse, error) {
+	if err := encoder.Encode(request); err != nil {
+		return nil, errors.Join(ErrAgent, err)
+	}
+
+	var response agentResponse
+	if err := decoder.Decode(&response); err != nil {
+		return nil, errors.Join(ErrAgent, err)
+	}
+
+	if response.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrAgent, response.Error)
+	}
+
+	return &response, nil
+}
+
+// dialAgent connects to the agent socket and verifies that the agent runs as the current user.
+func dialAgent(ctx context.Context, path string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: agentDialTimeout}
+	conn, err := dialer.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, errors.Join(ErrAgent, err)
+	}
+
+	if err := checkPeer(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// checkPeer verifies that the process on the other end of a Unix socket runs as the current user.
+func checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("%w: not a unix socket connection", ErrAgent)
+	}
+
+	uid, err := peerUID(unixConn)
+	if err != nil {
+		return errors.Join(ErrAgent, err)
+	}
+
+	if uid != os.Getuid() {
+		return fmt.Errorf("%w: peer runs as uid %d", ErrAgent, uid)
+	}
+
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !(darwin || linux)
+
+package storage
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID is not implemented on this platform, so the agent refuses all connections.
+func peerUID(conn *net.UnixConn) (int, error) {
+	return 0, errors.New("peer credentials are not supported on this platform")
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func startAgent(t *testing.T, provider StorageProvider) (string, <-chan string) {
+	// The temporary directory may be accessible by other users, the socket directory must not
+	path := filepath.Join(t.TempDir(), "agent", "agent.sock")
+	listener, err := ListenAgent(path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	changes := make(chan string, 10)
+	server := NewAgentServer(provider)
+	server.OnChange = func(key string) {
+		changes <- key
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- server.Serve(ctx, listener)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	return path, changes
+}
+
+func TestAgentStorage(t *testing.T) {
+	backing := NewMemoryStorage("test")
+	path, changes := startAgent(t, backing)
+
+	assert.True(t, AgentAvailable(path))
+	assert.False(t, AgentAvailable(filepath.Join(t.TempDir(), "missing.sock")))
+
+	client := NewAgentStorage(path)
+
+	_, err := client.GetToken()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	assert.NoError(t, client.SetToken(jwt.Token{Raw: "token"}))
+	assert.Equal(t, "", <-changes)
+
+	token, err := client.GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	token, err = backing.GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	keyed := client.WithKey("resource")
+	assert.NoError(t, keyed.SetToken(jwt.Token{Raw: "keyed"}))
+	assert.Equal(t, "resource", <-changes)
+
+	token, err = backing.(KeyedStorageProvider).WithKey("resource").GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "keyed", token)
+
+	keys, err := client.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"resource"}, keys)
+
+	assert.NoError(t, client.DeleteToken())
+	_, err = client.GetToken()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
+
+func TestAgentStorageLock(t *testing.T) {
+	backing := NewLockedStorage(NewMemoryStorage("test"), filepath.Join(t.TempDir(), "test.lock"))
+	path, _ := startAgent(t, backing)
+
+	client := NewAgentStorage(path).(Locker)
+
+	unlock, err := client.Lock(context.Background())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = client.Lock(ctx)
+	assert.Error(t, err)
+
+	assert.NoError(t, unlock())
+
+	unlock, err = client.Lock(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, unlock())
+}
+
+func TestAgentStorageRejectsNestedLock(t *testing.T) {
+	backing := NewLockedStorage(NewMemoryStorage("test"), filepath.Join(t.TempDir(), "test.lock"))
+	path, _ := startAgent(t, backing)
+
+	conn, err := dialAgent(context.Background(), path)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
+
+	_, err = exchange(encoder, decoder, agentRequest{Op: agentOpLock})
+	assert.NoError(t, err)
+	_, err = exchange(encoder, decoder, agentRequest{Op: agentOpLock})
+	assert.ErrorIs(t, err, ErrAgent)
+
+	// The first lock is still released by unlock
+	_, err = exchange(encoder, decoder, agentRequest{Op: agentOpUnlock})
+	assert.NoError(t, err)
+
+	unlock, err := NewAgentStorage(path).(Locker).Lock(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, unlock())
+}
+
+func TestListenAgentRejectsSharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Chmod(dir, 0o755))
+
+	_, err := ListenAgent(filepath.Join(dir, "agent.sock"))
+	assert.ErrorIs(t, err, ErrAgent)
+	_, err = os.Stat(filepath.Join(dir, "agent.sock"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// A new directory is created with mode 0700
+	path := filepath.Join(t.TempDir(), "agent", "agent.sock")
+	listener, err := ListenAgent(path)
+	assert.NoError(t, err)
+	listener.Close()
+
+	info, err := os.Stat(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+}
+
+func TestListenAgentRejectsRunningAgent(t *testing.T) {
+	path, _ := startAgent(t, NewMemoryStorage("test"))
+
+	_, err := ListenAgent(path)
+	assert.ErrorIs(t, err, ErrAgent)
+}
+
+func TestCachedStorage(t *testing.T) {
+	backing := NewMemoryStorage("test")
+	assert.NoError(t, backing.SetToken(jwt.Token{Raw: "token"}))
+
+	cached := NewCachedStorage(backing)
+	token, err := cached.GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	// Served from memory once read
+	assert.NoError(t, backing.DeleteToken())
+	token, err = cached.GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	// Writes go to the backing storage
+	assert.NoError(t, cached.WithKey("resource").SetToken(jwt.Token{Raw: "keyed"}))
+	token, err = backing.(KeyedStorageProvider).WithKey("resource").GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "keyed", token)
+}
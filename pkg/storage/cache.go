@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// cachedStorageProvider keeps the tokens of another storage provider in memory.
+type cachedStorageProvider struct {
+	backing StorageProvider
+	key     string
+	cache   *tokenCache
+}
+
+// tokenCache holds the cached tokens of a cached storage provider and all providers derived from it.
+type tokenCache struct {
+	mutex  sync.Mutex
+	tokens map[string]string
+}
+
+// NewCachedStorage returns a storage provider that reads each token from provider only once and
+// serves it from memory afterwards. Writes go to both. If provider implements Locker, so does the
+// returned provider; acquiring the lock drops the cache, since another process may have changed
+// the stored tokens. If provider does not implement KeyedStorageProvider, the tokens stored under
+// keys are only held in memory and are lost when the returned provider is discarded.
+func NewCachedStorage(provider StorageProvider) KeyedStorageProvider {
+	return &cachedStorageProvider{
+		backing: provider,
+		cache:   &tokenCache{tokens: map[string]string{}},
+	}
+}
+
+// WithKey implements KeyedStorageProvider.
+func (c *cachedStorageProvider) WithKey(key string) StorageProvider {
+	// Without a keyed backing provider, the token of the key is only held in memory
+	var backing StorageProvider
+	if keyed, ok := c.backing.(KeyedStorageProvider); ok {
+		backing = keyed.WithKey(key)
+	}
+
+	return &cachedStorageProvider{backing: backing, key: key, cache: c.cache}
+}
+
+// Keys implements KeyedStorageProvider. It returns the keys of the backing provider and the keys
+// of the tokens that are only held in memory.
+func (c *cachedStorageProvider) Keys() ([]string, error) {
+	var keys []string
+	if keyed, ok := c.backing.(KeyedStorageProvider); ok {
+		backingKeys, err := keyed.Keys()
+		if err != nil {
+			return nil, err
+		}
+		keys = backingKeys
+	}
+
+	c.cache.mutex.Lock()
+	for key := range c.cache.tokens {
+		if key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	c.cache.mutex.Unlock()
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// GetToken implements StorageProvider.
+func (c *cachedStorageProvider) GetToken() (string, error) {
+	c.cache.mutex.Lock()
+	defer c.cache.mutex.Unlock()
+
+	if token, ok := c.cache.tokens[c.key]; ok {
+		return token, nil
+	}
+
+	if c.backing == nil {
+		return "", ErrTokenNotFound
+	}
+
+	token, err := c.backing.GetToken()
+	if err != nil {
+		return "", err
+	}
+
+	c.cache.tokens[c.key] = token
+	return token, nil
+}
+
+// SetToken implements StorageProvider.
+func (c *cachedStorageProvider) SetToken(token jwt.Token) error {
+	c.cache.mutex.Lock()
+	defer c.cache.mutex.Unlock()
+
+	if c.backing != nil {
+		if err := c.backing.SetToken(token); err != nil {
+			return err
+		}
+	}
+
+	c.cache.tokens[c.key] = token.Raw
+	return nil
+}
+
+// DeleteToken implements StorageProvider.
+func (c *cachedStorageProvider) DeleteToken() error {
+	c.cache.mutex.Lock()
+	defer c.cache.mutex.Unlock()
+
+	delete(c.cache.tokens, c.key)
+
+	if c.backing == nil {
+		return nil
+	}
+
+	if err := c.backing.DeleteToken(); err != nil && !errors.Is(err, ErrTokenNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Lock implements Locker.
+func (c *cachedStorageProvider) Lock(ctx context.Context) (func() error, error) {
+	locker, ok := c.backing.(Locker)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+
+	unlock, err := locker.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.mutex.Lock()
+	clear(c.cache.tokens)
+	c.cache.mutex.Unlock()
+
+	return unlock, nil
+}
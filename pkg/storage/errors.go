@@ -7,4 +7,6 @@ var (
 	ErrInvalidToken  = errors.New("invalid token")
 	ErrDeleteToken   = errors.New("error deleting token")
 	ErrSetToken      = errors.New("error setting token")
+	ErrLock          = errors.New("error acquiring storage lock")
+	ErrAgent         = errors.New("error communicating with token agent")
 )
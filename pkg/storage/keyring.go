@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"slices"
 
 	"github.com/golang-jwt/jwt"
 	keyring "github.com/zalando/go-keyring"
@@ -9,21 +12,100 @@ import (
 
 type keyringStorageProvider struct {
 	service string
+	key     string
 }
 
 func NewKeyringStorage(service string) StorageProvider {
 	return &keyringStorageProvider{service: service}
 }
 
+// WithKey implements KeyedStorageProvider.
+func (k *keyringStorageProvider) WithKey(key string) StorageProvider {
+	return &keyringStorageProvider{service: k.service, key: key}
+}
+
+// Keys implements KeyedStorageProvider. System keyrings cannot enumerate their entries, so the
+// keys are recorded in an index entry of the service when tokens are stored under them.
+func (k *keyringStorageProvider) Keys() ([]string, error) {
+	raw, err := keyring.Get(k.service, k.indexUser())
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	return keys, nil
+}
+
+// indexUser returns the keyring user the keys of the service are recorded under. It cannot
+// collide with the user of a token, since those are the service or have a ":" after it.
+func (k *keyringStorageProvider) indexUser() string {
+	return k.service + "#keys"
+}
+
+// updateIndex adds the key of the provider to the index of the service, or removes it.
+func (k *keyringStorageProvider) updateIndex(add bool) error {
+	keys, err := k.Keys()
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(keys, k.key) == add {
+		return nil
+	}
+	if add {
+		keys = append(keys, k.key)
+	} else {
+		keys = slices.DeleteFunc(keys, func(key string) bool { return key == k.key })
+	}
+
+	if len(keys) == 0 {
+		if err := keyring.Delete(k.service, k.indexUser()); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	raw, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return keyring.Set(k.service, k.indexUser(), string(raw))
+}
+
+// user returns the keyring user the token is stored under.
+func (k *keyringStorageProvider) user() string {
+	if k.key == "" {
+		return k.service
+	}
+	return k.service + ":" + k.key
+}
+
+// Lock implements Locker with a lock file in the user cache directory, which is shared by all
+// processes that use the same service.
+func (k *keyringStorageProvider) Lock(ctx context.Context) (func() error, error) {
+	return NewFileLock(DefaultLockPath(k.service)).Lock(ctx)
+}
+
 func (k *keyringStorageProvider) SetToken(token jwt.Token) error {
-	if err := keyring.Set(k.service, k.service, token.Raw); err != nil {
+	if err := keyring.Set(k.service, k.user(), token.Raw); err != nil {
 		return errors.Join(ErrSetToken, err)
 	}
+	if k.key != "" {
+		if err := k.updateIndex(true); err != nil {
+			return errors.Join(ErrSetToken, err)
+		}
+	}
 	return nil
 }
 
 func (k *keyringStorageProvider) GetToken() (string, error) {
-	token, err := keyring.Get(k.service, k.service)
+	token, err := keyring.Get(k.service, k.user())
 	if err != nil {
 		if errors.Is(err, keyring.ErrNotFound) {
 			return "", ErrTokenNotFound
@@ -35,5 +117,15 @@ func (k *keyringStorageProvider) GetToken() (string, error) {
 }
 
 func (k *keyringStorageProvider) DeleteToken() error {
-	return keyring.Delete(k.service, k.service)
+	if k.key != "" {
+		if err := k.updateIndex(false); err != nil {
+			return err
+		}
+	}
+
+	err := keyring.Delete(k.service, k.user())
+	if errors.Is(err, keyring.ErrNotFound) {
+		return ErrTokenNotFound
+	}
+	return err
 }
@@ -64,7 +64,7 @@ func TestDeleteToken(t *testing.T) {
 		keyring.MockInit()
 
 		err := provider.DeleteToken()
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTokenNotFound)
 	})
 
 	t.Run("Other error", func(t *testing.T) {
@@ -114,3 +114,31 @@ func TestNewKeyringStorage(t *testing.T) {
 	assert.IsType(t, &keyringStorageProvider{}, provider)
 	assert.Equal(t, service, provider.(*keyringStorageProvider).service)
 }
+
+func TestKeyringStorageWithKey(t *testing.T) {
+	service := "testService"
+	keyring.MockInit()
+
+	provider := NewKeyringStorage(service)
+	keyed := provider.(KeyedStorageProvider).WithKey("resource")
+
+	assert.NoError(t, provider.SetToken(jwt.Token{Raw: "defaultToken"}))
+	assert.NoError(t, keyed.SetToken(jwt.Token{Raw: "keyedToken"}))
+
+	storedToken, err := keyring.Get(service, service)
+	assert.NoError(t, err)
+	assert.Equal(t, "defaultToken", storedToken)
+
+	storedToken, err = keyring.Get(service, service+":resource")
+	assert.NoError(t, err)
+	assert.Equal(t, "keyedToken", storedToken)
+
+	keys, err := provider.(KeyedStorageProvider).Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"resource"}, keys)
+
+	assert.NoError(t, keyed.DeleteToken())
+	keys, err = provider.(KeyedStorageProvider).Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// lockRetryInterval is the delay between attempts to acquire a file lock that is held by another process.
+const lockRetryInterval = 50 * time.Millisecond
+
+// Locker is implemented by storage providers that support an exclusive lock across processes.
+// The lock is held around read-refresh-write cycles, so that only one process refreshes a token
+// and the others pick up the stored result.
+type Locker interface {
+	// Lock blocks until the lock is acquired or ctx is done. The returned function releases the lock.
+	Lock(ctx context.Context) (unlock func() error, err error)
+}
+
+// FileLock is an advisory lock on a file (flock on Unix, LockFileEx on Windows).
+type FileLock struct {
+	path string
+}
+
+// NewFileLock creates a lock on the file at path. The file and its directory are created when
+// the lock is acquired for the first time.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Lock implements Locker.
+func (l *FileLock) Lock(ctx context.Context) (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return nil, errors.Join(ErrLock, err)
+	}
+
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, errors.Join(ErrLock, err)
+	}
+
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, errors.Join(ErrLock, err)
+		}
+
+		if locked {
+			return func() error {
+				err := unlockFile(file)
+				return errors.Join(err, file.Close())
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, fmt.Errorf("%w: %w", ErrLock, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// lockedStorageProvider adds a file lock to a storage provider.
+type lockedStorageProvider struct {
+	StorageProvider
+	lock *FileLock
+}
+
+// Lock implements Locker.
+func (l *lockedStorageProvider) Lock(ctx context.Context) (func() error, error) {
+	return l.lock.Lock(ctx)
+}
+
+// lockedKeyedStorageProvider adds a file lock to a keyed storage provider.
+type lockedKeyedStorageProvider struct {
+	lockedStorageProvider
+	keyed KeyedStorageProvider
+}
+
+// WithKey implements KeyedStorageProvider.
+func (l *lockedKeyedStorageProvider) WithKey(key string) StorageProvider {
+	return &lockedStorageProvider{StorageProvider: l.keyed.WithKey(key), lock: l.lock}
+}
+
+// Keys implements KeyedStorageProvider.
+func (l *lockedKeyedStorageProvider) Keys() ([]string, error) {
+	return l.keyed.Keys()
+}
+
+// NewLockedStorage adds cross-process locking with a lock file at path to a storage provider.
+// The returned provider implements KeyedStorageProvider if the given provider does.
+func NewLockedStorage(provider StorageProvider, path string) StorageProvider {
+	locked := lockedStorageProvider{StorageProvider: provider, lock: NewFileLock(path)}
+	if keyed, ok := provider.(KeyedStorageProvider); ok {
+		return &lockedKeyedStorageProvider{lockedStorageProvider: locked, keyed: keyed}
+	}
+	return &locked
+}
+
+var unsafeFileNameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// DefaultLockPath returns the path of the lock file for the given service in the user cache directory.
+func DefaultLockPath(service string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "cobra-oauth2", unsafeFileNameCharacters.ReplaceAllString(service, "_")+".lock")
+}
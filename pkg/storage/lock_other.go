@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package storage
+
+import "os"
+
+// Advisory file locks are not available on this platform, the lock always succeeds.
+func tryLockFile(file *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "test.lock")
+
+	unlock, err := NewFileLock(path).Lock(context.Background())
+	assert.NoError(t, err)
+
+	// A second lock on the same file waits until the first one is released
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = NewFileLock(path).Lock(ctx)
+	assert.True(t, errors.Is(err, ErrLock))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	acquired := make(chan error)
+	go func() {
+		unlock, err := NewFileLock(path).Lock(context.Background())
+		if err == nil {
+			err = unlock()
+		}
+		acquired <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, unlock())
+
+	select {
+	case err := <-acquired:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock was not acquired after release")
+	}
+}
+
+func TestNewLockedStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	provider := NewLockedStorage(NewMemoryStorage("test"), path)
+
+	_, ok := provider.(Locker)
+	assert.True(t, ok)
+
+	keyed, ok := provider.(KeyedStorageProvider)
+	assert.True(t, ok)
+
+	_, ok = keyed.WithKey("resource").(Locker)
+	assert.True(t, ok)
+}
+
+func TestDefaultLockPath(t *testing.T) {
+	path := DefaultLockPath("my/service:name")
+	assert.Equal(t, "my_service_name.lock", filepath.Base(path))
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"slices"
 	"sync"
 
 	"github.com/golang-jwt/jwt"
@@ -10,40 +11,72 @@ import (
 // Uses a mutex to be thread-safe.
 type memoryStorageProvider struct {
 	service string
-	mutex   sync.Mutex
-	token   string
+	key     string
+	store   *memoryStore
+}
+
+// memoryStore holds the tokens of a memory storage provider and all providers derived from it.
+type memoryStore struct {
+	mutex  sync.Mutex
+	tokens map[string]string
 }
 
 func NewMemoryStorage(service string) StorageProvider {
 	return &memoryStorageProvider{
-		mutex:   sync.Mutex{},
 		service: service,
-		token:   "",
+		store: &memoryStore{
+			mutex:  sync.Mutex{},
+			tokens: map[string]string{},
+		},
+	}
+}
+
+// WithKey implements KeyedStorageProvider.
+func (m *memoryStorageProvider) WithKey(key string) StorageProvider {
+	return &memoryStorageProvider{
+		service: m.service,
+		key:     key,
+		store:   m.store,
+	}
+}
+
+// Keys implements KeyedStorageProvider.
+func (m *memoryStorageProvider) Keys() ([]string, error) {
+	m.store.mutex.Lock()
+	defer m.store.mutex.Unlock()
+
+	keys := make([]string, 0, len(m.store.tokens))
+	for key := range m.store.tokens {
+		if key != "" {
+			keys = append(keys, key)
+		}
 	}
+	slices.Sort(keys)
+	return keys, nil
 }
 
 // DeleteToken implements StorageProvider.
 func (m *memoryStorageProvider) DeleteToken() error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	m.token = ""
+	m.store.mutex.Lock()
+	defer m.store.mutex.Unlock()
+	delete(m.store.tokens, m.key)
 	return nil
 }
 
 // GetToken implements StorageProvider.
 func (m *memoryStorageProvider) GetToken() (string, error) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	if m.token != "" {
-		return m.token, nil
+	m.store.mutex.Lock()
+	defer m.store.mutex.Unlock()
+	if token := m.store.tokens[m.key]; token != "" {
+		return token, nil
 	}
 	return "", ErrTokenNotFound
 }
 
 // SetToken implements StorageProvider.
 func (m *memoryStorageProvider) SetToken(token jwt.Token) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	m.token = token.Raw
+	m.store.mutex.Lock()
+	defer m.store.mutex.Unlock()
+	m.store.tokens[m.key] = token.Raw
 	return nil
 }
@@ -33,3 +33,36 @@ func TestMemoryStorageProvider(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, "", retrievedToken)
 }
+
+func TestMemoryStorageProviderWithKey(t *testing.T) {
+	provider := NewMemoryStorage("test")
+	keyed := provider.(KeyedStorageProvider).WithKey("resource")
+
+	assert.NoError(t, provider.SetToken(jwt.Token{Raw: "defaultToken"}))
+	assert.NoError(t, keyed.SetToken(jwt.Token{Raw: "keyedToken"}))
+
+	token, err := provider.GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "defaultToken", token)
+
+	token, err = keyed.GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "keyedToken", token)
+
+	// Keys share the underlying store
+	token, err = provider.(KeyedStorageProvider).WithKey("resource").GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "keyedToken", token)
+
+	keys, err := provider.(KeyedStorageProvider).Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"resource"}, keys)
+
+	assert.NoError(t, keyed.DeleteToken())
+	_, err = keyed.GetToken()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	token, err = provider.GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "defaultToken", token)
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// prefixedStorageProvider stores its tokens under a prefix of the keys of another storage provider.
+type prefixedStorageProvider struct {
+	backing KeyedStorageProvider
+	prefix  string
+	key     string
+}
+
+// NewPrefixedStorage returns a storage provider that stores its default token under prefix and
+// the token of key under prefix/key in provider, so that several configurations can share a
+// provider without reading each other's tokens. If provider implements Locker, so does the
+// returned provider.
+func NewPrefixedStorage(provider KeyedStorageProvider, prefix string) KeyedStorageProvider {
+	return &prefixedStorageProvider{backing: provider, prefix: prefix}
+}
+
+// WithKey implements KeyedStorageProvider.
+func (p *prefixedStorageProvider) WithKey(key string) StorageProvider {
+	return &prefixedStorageProvider{backing: p.backing, prefix: p.prefix, key: key}
+}
+
+// Keys implements KeyedStorageProvider.
+func (p *prefixedStorageProvider) Keys() ([]string, error) {
+	backingKeys, err := p.backing.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, key := range backingKeys {
+		if key, ok := strings.CutPrefix(key, p.prefix+"/"); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// provider returns the provider of the backing storage for the key.
+func (p *prefixedStorageProvider) provider() StorageProvider {
+	if p.key == "" {
+		return p.backing.WithKey(p.prefix)
+	}
+	return p.backing.WithKey(p.prefix + "/" + p.key)
+}
+
+// GetToken implements StorageProvider.
+func (p *prefixedStorageProvider) GetToken() (string, error) {
+	return p.provider().GetToken()
+}
+
+// SetToken implements StorageProvider.
+func (p *prefixedStorageProvider) SetToken(token jwt.Token) error {
+	return p.provider().SetToken(token)
+}
+
+// DeleteToken implements StorageProvider.
+func (p *prefixedStorageProvider) DeleteToken() error {
+	return p.provider().DeleteToken()
+}
+
+// Lock implements Locker.
+func (p *prefixedStorageProvider) Lock(ctx context.Context) (func() error, error) {
+	locker, ok := p.backing.(Locker)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+	return locker.Lock(ctx)
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixedStorageProvider(t *testing.T) {
+	backing := NewMemoryStorage("test").(KeyedStorageProvider)
+	staging := NewPrefixedStorage(backing, "profile:staging")
+	prod := NewPrefixedStorage(backing, "profile:prod")
+
+	assert.NoError(t, staging.SetToken(jwt.Token{Raw: "staging_token"}))
+	assert.NoError(t, staging.WithKey("resource").SetToken(jwt.Token{Raw: "staging_resource_token"}))
+
+	token, err := staging.GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "staging_token", token)
+
+	token, err = backing.WithKey("profile:staging/resource").GetToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "staging_resource_token", token)
+
+	// Other prefixes and the backing provider do not see the tokens
+	_, err = prod.GetToken()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	_, err = prod.WithKey("resource").GetToken()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	_, err = backing.GetToken()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	keys, err := staging.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"resource"}, keys)
+	keys, err = prod.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	assert.NoError(t, staging.DeleteToken())
+	_, err = staging.GetToken()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
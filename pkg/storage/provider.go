@@ -9,3 +9,12 @@ type StorageProvider interface {
 	GetToken() (string, error)
 	DeleteToken() error
 }
+
+// KeyedStorageProvider is implemented by storage providers that can hold more than one token.
+// WithKey returns a provider for the token stored under the given key, next to the default token,
+// and Keys returns the keys that tokens are stored under, so that they can be removed.
+type KeyedStorageProvider interface {
+	StorageProvider
+	WithKey(key string) StorageProvider
+	Keys() ([]string, error)
+}